@@ -0,0 +1,99 @@
+package ohauth
+
+import (
+	"fmt"
+	"time"
+)
+
+// assertionAlgs lists the JWS algorithms accepted for assertions
+var assertionAlgs = []string{"ES256", "ES384", "ES512", "HS256", "HS384", "HS512", "RS256", "RS384", "RS512"}
+
+// assertion holds the verified claims of a JWT assertion (rfc7523 section 3)
+type assertion struct {
+	Issuer  string
+	Subject string
+	ID      string
+	Expires time.Time
+	claims  map[string]interface{}
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+func claimTime(claims map[string]interface{}, name string) (time.Time, bool) {
+	f, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// claimAudience reports whether an aud claim, which may be a string or an array
+// of strings, contains one of the expected values
+func claimAudience(claims map[string]interface{}, expected ...string) bool {
+	auds := []interface{}{claims["aud"]}
+	if list, ok := claims["aud"].([]interface{}); ok {
+		auds = list
+	}
+	for _, a := range auds {
+		for _, e := range expected {
+			if s, ok := a.(string); ok && s != "" && s == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// assertionKey returns the key that verifies an assertion from an issuer. The
+// kid is taken from the assertion header and may be empty.
+type assertionKey func(iss, kid string) (interface{}, error)
+
+// jwksKey finds a public key in a key set
+func jwksKey(set *JWKSet, kid string) (interface{}, error) {
+	k := set.Find(kid)
+	if k == nil {
+		return nil, fmt.Errorf("no key found to verify assertion")
+	}
+	return k.PublicKey()
+}
+
+// verifyAssertion checks the signature and the iss, sub, aud, exp and jti claims
+// of a JWT assertion. The audience must identify the provider or its token
+// endpoint and the jti is recorded so that the assertion cannot be replayed. A
+// nil assertion is returned if it is not valid.
+func verifyAssertion(ctx *context, raw string, key assertionKey) (*assertion, error) {
+	p := ctx.provider
+	claims, err := parseSignedClaims(raw, func(header, claims map[string]interface{}) (interface{}, error) {
+		return key(claimString(claims, "iss"), claimString(header, "kid"))
+	})
+	if err != nil {
+		return nil, nil
+	}
+
+	a := &assertion{
+		Issuer:  claimString(claims, "iss"),
+		Subject: claimString(claims, "sub"),
+		ID:      claimString(claims, "jti"),
+		claims:  claims,
+	}
+	exp, ok := claimTime(claims, "exp")
+	if !ok || !exp.After(ctx.timestamp) {
+		return nil, nil
+	}
+	a.Expires = exp
+	if a.Issuer == "" || a.Subject == "" || a.ID == "" {
+		return nil, nil
+	}
+	if !claimAudience(claims, p.URL.String(), p.endpoint(""), p.endpoint("/token")) {
+		return nil, nil
+	}
+
+	used, err := replayed(p.Store, "assertion:"+a.Issuer+":"+a.ID, a.Expires)
+	if err != nil || used {
+		return nil, err
+	}
+	return a, nil
+}
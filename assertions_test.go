@@ -0,0 +1,113 @@
+package ohauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// newAssertionKey creates an ES256 key pair along with its public JWK
+func newAssertionKey(t *testing.T) (*ecdsa.PrivateKey, *JWK) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewJWK(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, k
+}
+
+func signAssertion(t *testing.T, method jwt.SigningMethod, key interface{}, header, claims map[string]interface{}) string {
+	token := jwt.New(method)
+	for k, v := range header {
+		token.Header[k] = v
+	}
+	token.Claims = claims
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestGrant_jwtBearer(t *testing.T) {
+	key, k := newAssertionKey(t)
+	client := NewClient("Backend Service", JWTBearer)
+	client.Scope = ParseScope("orders")
+	client.Status = ClientActive
+	client.JWKS = &JWKSet{Keys: []*JWK{k}}
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := time.Now().Add(5 * time.Minute).Unix()
+	valid := signAssertion(t, jwt.SigningMethodES256, key, map[string]interface{}{"kid": k.KeyID}, map[string]interface{}{
+		"iss": client.ID, "sub": client.ID, "aud": testProvider.endpoint("/token"), "exp": exp, "jti": randID(),
+	})
+	table := []struct {
+		name      string
+		assertion string
+		status    int
+	}{
+		{"valid", valid, http.StatusOK},
+		{"replayed", valid, http.StatusBadRequest},
+		{"other subject", signAssertion(t, jwt.SigningMethodES256, key, nil, map[string]interface{}{
+			"iss": client.ID, "sub": "testuser", "aud": testProvider.URL.String(), "exp": exp, "jti": randID(),
+		}), http.StatusBadRequest},
+		{"wrong audience", signAssertion(t, jwt.SigningMethodES256, key, nil, map[string]interface{}{
+			"iss": client.ID, "sub": client.ID, "aud": "https://other.example.com", "exp": exp, "jti": randID(),
+		}), http.StatusBadRequest},
+		{"no expiry", signAssertion(t, jwt.SigningMethodES256, key, nil, map[string]interface{}{
+			"iss": client.ID, "sub": client.ID, "aud": testProvider.URL.String(), "jti": randID(),
+		}), http.StatusBadRequest},
+	}
+	for _, r := range table {
+		status, out := postGrant(t, url.Values{
+			"grant_type":    {JWTBearer},
+			"client_id":     {client.ID},
+			"client_secret": {client.Secret},
+			"assertion":     {r.assertion},
+			"scope":         {"orders"},
+		})
+		if status != r.status {
+			t.Fatalf("%s: EXPECTED = %d - GOT = %d %v", r.name, r.status, status, out)
+		}
+	}
+}
+
+func TestReplayed(t *testing.T) {
+	s, err := NewTestingStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, r := range []struct {
+		id   string
+		exp  time.Time
+		used bool
+	}{
+		{"expired", now.Add(-time.Second), false},
+		{"expired", now.Add(time.Minute), false},
+		{"expired", now.Add(time.Minute), true},
+		{"other", now.Add(time.Minute), false},
+	} {
+		used, err := replayed(s, r.id, r.exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != r.used {
+			t.Fatalf("%s: EXPECTED = %t - GOT = %t", r.id, r.used, used)
+		}
+	}
+	if bl, _ := s.TokenBlacklisted("other"); bl {
+		t.Fatal("replay id was kept in the token blacklist")
+	}
+}
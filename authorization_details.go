@@ -0,0 +1,121 @@
+package ohauth
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// AuthorizationDetail is a single object of the authorization_details
+// parameter (rfc9396 section 2). Its type member identifies which other members
+// it may carry, such as locations, actions or an amount for a payment.
+type AuthorizationDetail map[string]interface{}
+
+// Type returns the type member of an authorization detail
+func (d AuthorizationDetail) Type() string {
+	t, _ := d["type"].(string)
+	return t
+}
+
+// AuthorizationDetailValidator checks that an authorization detail of a
+// registered type is well formed and may be requested by a client
+type AuthorizationDetailValidator func(c *Client, d AuthorizationDetail) bool
+
+// AuthorizationDetails are the fine-grained permissions requested by a client
+// in addition to, or instead of, a scope
+type AuthorizationDetails []AuthorizationDetail
+
+// ParseAuthorizationDetails parses the JSON array sent as the
+// authorization_details parameter. Every detail must have a type.
+func ParseAuthorizationDetails(raw string) (AuthorizationDetails, error) {
+	ds := AuthorizationDetails{}
+	if err := json.Unmarshal([]byte(raw), &ds); err != nil {
+		return nil, err
+	}
+	for _, d := range ds {
+		if d.Type() == "" {
+			return nil, ErrBadAuthzDetails
+		}
+	}
+	return ds, nil
+}
+
+// String returns the JSON representation of the authorization details
+func (ds AuthorizationDetails) String() string {
+	b, err := json.Marshal(ds)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// Contains determines if every detail of another set of authorization details
+// is also one of these details
+func (ds AuthorizationDetails) Contains(ds2 AuthorizationDetails) bool {
+	for _, d2 := range ds2 {
+		found := false
+		for _, d := range ds {
+			found = found || sameDetail(d, d2)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Equals determines if two sets of authorization details hold the same details
+func (ds AuthorizationDetails) Equals(ds2 AuthorizationDetails) bool {
+	return len(ds) == len(ds2) && ds.Contains(ds2) && ds2.Contains(ds)
+}
+
+// sameDetail compares details by their JSON encoding which orders object
+// members by name
+func sameDetail(d, d2 AuthorizationDetail) bool {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return false
+	}
+	b2, err := json.Marshal(d2)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(b, b2)
+}
+
+// authorizationDetails parses and validates the authorization_details
+// requested by a client. Each detail must be of a type registered with the
+// provider that the client may use and must satisfy the type's validator. Nil
+// details and false are returned if they are not valid.
+func (p *Provider) authorizationDetails(c *Client, raw string) (AuthorizationDetails, bool) {
+	if raw == "" {
+		return nil, true
+	}
+	ds, err := ParseAuthorizationDetails(raw)
+	if err != nil {
+		return nil, false
+	}
+	for _, d := range ds {
+		validate, found := p.AuthorizationDetailTypes[d.Type()]
+		if !found || !c.AllowsAuthorizationDetailType(d.Type()) {
+			return nil, false
+		}
+		if validate != nil && !validate(c, d) {
+			return nil, false
+		}
+	}
+	return ds, true
+}
+
+// narrowDetails parses the authorization_details sent with a token request,
+// which may only ask for a subset of the details originally granted (rfc9396
+// section 6.1). The granted details are returned if none were sent.
+func narrowDetails(granted AuthorizationDetails, raw string) (AuthorizationDetails, bool) {
+	if raw == "" {
+		return granted, true
+	}
+	ds, err := ParseAuthorizationDetails(raw)
+	if err != nil || !granted.Contains(ds) {
+		return nil, false
+	}
+	return ds, true
+}
@@ -0,0 +1,169 @@
+package ohauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAuthorizationDetails(t *testing.T) {
+	table := []struct {
+		raw   string
+		valid bool
+	}{
+		{`[{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":"45.00"}}]`, true},
+		{`[{"type":"account_information","actions":["list_accounts"]},{"type":"payment_initiation"}]`, true},
+		{`[]`, true},
+		{`[{"actions":["read"]}]`, false},
+		{`{"type":"payment_initiation"}`, false},
+		{`payment_initiation`, false},
+	}
+	for _, r := range table {
+		_, err := ParseAuthorizationDetails(r.raw)
+		if (err == nil) != r.valid {
+			t.Fatalf("%s: EXPECTED valid = %t - GOT = %v", r.raw, r.valid, err)
+		}
+	}
+
+	granted, _ := ParseAuthorizationDetails(`[{"type":"a","actions":["read","write"]},{"type":"b"}]`)
+	subset, _ := ParseAuthorizationDetails(`[{"actions":["read","write"],"type":"a"}]`)
+	other, _ := ParseAuthorizationDetails(`[{"type":"a","actions":["read"]}]`)
+	if !granted.Contains(subset) || granted.Contains(other) || granted.Equals(subset) || !subset.Equals(subset) {
+		t.Fatal("authorization details were not compared by value")
+	}
+}
+
+func TestAuthorize_authorizationDetails(t *testing.T) {
+	p := *testProvider
+	p.Authenticator = &subjectAuthenticator{testProvider.Authenticator, "raruser"}
+	p.AuthorizationDetailTypes = map[string]AuthorizationDetailValidator{
+		"payment_initiation": func(c *Client, d AuthorizationDetail) bool {
+			amount, _ := d["instructedAmount"].(map[string]interface{})
+			return amount["currency"] == "EUR"
+		},
+		"account_information": nil,
+	}
+
+	client := NewClient("Test Client", AuthorizationCode, RefreshToken)
+	client.Scope = ParseScope("payments")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://example.com/cb")}
+	if err := p.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	payment := `{"type":"payment_initiation","instructedAmount":{"currency":"EUR","amount":"45.00"},"creditorAccount":{"iban":"DE02100100109307118603"}}`
+	accounts := `{"type":"account_information","actions":["list_accounts"]}`
+	details := "[" + payment + "," + accounts + "]"
+	authorize := func(method string, raw string) *httptest.ResponseRecorder {
+		q := url.Values{
+			"client_id":             {client.ID},
+			"response_type":         {"code"},
+			"redirect_uri":          {"https://example.com/cb"},
+			"scope":                 {"payments"},
+			"state":                 {"rar"},
+			"authorization_details": {raw},
+		}
+		r := httptest.NewRequest(method, "https://authz.example.com/authorize?"+q.Encode(), nil)
+		if method == "POST" {
+			r = httptest.NewRequest(method, "https://authz.example.com/authorize", strings.NewReader(q.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		if err := handleAuthorize(&context{&p, w, r, time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	for _, raw := range []string{
+		`[{"type":"payment_initiation","instructedAmount":{"currency":"USD","amount":"45.00"}}]`,
+		`[{"type":"unknown"}]`,
+		`not json`,
+	} {
+		if loc := authorize("GET", raw).Header().Get("Location"); !strings.Contains(loc, "error="+InvalidAuthzDetails) {
+			t.Fatalf("%s: EXPECTED %s - GOT = %s", raw, InvalidAuthzDetails, loc)
+		}
+	}
+
+	loc, err := url.Parse(authorize("GET", details).Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shown, err := ParseAuthorizationDetails(loc.Query().Get("authorization_details"))
+	if err != nil || loc.Path != "/dialog" || len(shown) != 2 {
+		t.Fatalf("EXPECTED details to be passed to the dialog - GOT = %s", loc)
+	}
+
+	loc, err = url.Parse(authorize("POST", details).Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Store.FetchAuthorization(client.ID, "raruser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == nil || !a.Details.Equals(shown) {
+		t.Fatalf("approved details were not stored: %+v", a)
+	}
+
+	grant := func(form url.Values) (int, map[string]interface{}) {
+		form.Set("client_id", client.ID)
+		form.Set("client_secret", client.Secret)
+		r := httptest.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := handleGrant(&context{&p, w, r, time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]interface{}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, out
+	}
+	code := loc.Query().Get("code")
+	status, out := grant(url.Values{
+		"grant_type":            {AuthorizationCode},
+		"code":                  {code},
+		"redirect_uri":          {"https://example.com/cb"},
+		"authorization_details": {`[{"type":"account_information","actions":["list_accounts","list_transactions"]}]`},
+	})
+	if status != http.StatusBadRequest || out["error"] != InvalidAuthzDetails {
+		t.Fatalf("details beyond the grant: EXPECTED = %s - GOT = %d %v", InvalidAuthzDetails, status, out)
+	}
+	status, out = grant(url.Values{
+		"grant_type":   {AuthorizationCode},
+		"code":         {code},
+		"redirect_uri": {"https://example.com/cb"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("EXPECTED = %d - GOT = %d %v", http.StatusOK, status, out)
+	}
+	if granted, ok := out["authorization_details"].([]interface{}); !ok || len(granted) != 2 {
+		t.Fatalf("granted details were not returned: %v", out["authorization_details"])
+	}
+
+	status, out = grant(url.Values{
+		"grant_type":            {RefreshToken},
+		"refresh_token":         {out["refresh_token"].(string)},
+		"authorization_details": {"[" + accounts + "]"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("narrowed refresh: EXPECTED = %d - GOT = %d %v", http.StatusOK, status, out)
+	}
+
+	r := httptest.NewRequest("POST", "https://authz.example.com/introspect", nil)
+	res, err := introspect(&context{&p, httptest.NewRecorder(), r, time.Now()}, out["access_token"].(string), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := ParseAuthorizationDetails("[" + accounts + "]")
+	if !res.Active || !res.AuthorizationDetails.Equals(expected) {
+		t.Fatalf("introspection did not describe the narrowed details: %+v", res)
+	}
+}
@@ -0,0 +1,116 @@
+package ohauth
+
+import (
+	"sync"
+	"time"
+)
+
+// possible values for backchannel authentication status
+const (
+	BackchannelPending  = "pending"
+	BackchannelApproved = "approved"
+	BackchannelDenied   = "denied"
+	BackchannelRedeemed = "redeemed"
+)
+
+// Token delivery modes of client initiated backchannel authentication (CIBA
+// core section 5)
+const (
+	DeliveryPoll = "poll"
+	DeliveryPing = "ping"
+	DeliveryPush = "push"
+)
+
+// default polling interval of clients using the poll and ping modes
+const backchannelPollInterval = 5 * time.Second
+
+// BackchannelAuthentication tracks a backchannel authentication request (CIBA)
+// from the moment a client asks for a resource owner's approval until the
+// tokens are delivered
+type BackchannelAuthentication struct {
+	AuthReqID         string        `json:"authReqID"`
+	CID               string        `json:"cid"`
+	UID               string        `json:"uid"`
+	Scope             Scope         `json:"scope"`
+	BindingMessage    string        `json:"bindingMessage,omitempty"`
+	NotificationToken string        `json:"notificationToken,omitempty"`
+	Status            string        `json:"status"`
+	Interval          time.Duration `json:"interval"`
+	LastPolled        time.Time     `json:"lastPolled"`
+	Approved          time.Time     `json:"approved"`
+	Expires           time.Time     `json:"expires"`
+	Created           time.Time     `json:"created"`
+}
+
+// NewBackchannelAuthentication creates a pending backchannel authentication
+// request for a resource owner with a random auth_req_id
+func NewBackchannelAuthentication(cid, uid string, scope Scope, iat, exp time.Time) *BackchannelAuthentication {
+	return &BackchannelAuthentication{
+		AuthReqID: randToken(),
+		CID:       cid,
+		UID:       uid,
+		Scope:     scope,
+		Status:    BackchannelPending,
+		Interval:  backchannelPollInterval,
+		Expires:   exp,
+		Created:   iat,
+	}
+}
+
+// BackchannelApprover is implemented by applications to find the resource
+// owner named in a backchannel authentication request and to ask for their
+// approval on a device of their own, such as their phone. Backchannel
+// authentication is disabled without one.
+type BackchannelApprover interface {
+	// IdentifyUser returns the subject of the resource owner named by a
+	// login_hint or login_hint_token, depending on kind, or an empty string if
+	// the hint identifies nobody
+	IdentifyUser(c *Client, kind, hint string) (string, error)
+	// RequestApproval asks a resource owner to approve a request. It must not
+	// wait for their decision which is reported with
+	// Provider.CompleteBackchannelAuthentication.
+	RequestApproval(c *Client, b *BackchannelAuthentication) error
+}
+
+// TestingApprover is a BackchannelApprover that may be used for testing and
+// experimenting with OhAuth. Login hints are the subjects of a fixed set of
+// users and requests awaiting approval are kept in memory.
+type TestingApprover struct {
+	*sync.Mutex
+	users   map[string]bool
+	pending []*BackchannelAuthentication
+}
+
+// NewTestingApprover creates a TestingApprover that knows the specified users
+func NewTestingApprover(users ...string) *TestingApprover {
+	a := &TestingApprover{&sync.Mutex{}, map[string]bool{}, nil}
+	for _, u := range users {
+		a.users[u] = true
+	}
+	return a
+}
+
+// IdentifyUser returns the hint if it is the subject of a known user
+func (a *TestingApprover) IdentifyUser(c *Client, kind, hint string) (string, error) {
+	if kind != "login_hint" || !a.users[hint] {
+		return "", nil
+	}
+	return hint, nil
+}
+
+// RequestApproval records a request awaiting approval
+func (a *TestingApprover) RequestApproval(c *Client, b *BackchannelAuthentication) error {
+	a.Lock()
+	defer a.Unlock()
+	a.pending = append(a.pending, b)
+	return nil
+}
+
+// Pending returns and forgets the requests awaiting approval
+func (a *TestingApprover) Pending() []*BackchannelAuthentication {
+	a.Lock()
+	defer a.Unlock()
+	out := a.pending
+	a.pending = nil
+	return out
+}
@@ -0,0 +1,188 @@
+package ohauth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client authentication methods registered in rfc7591 section 2
+const (
+	ClientSecretBasic = "client_secret_basic"
+	ClientSecretPost  = "client_secret_post"
+	ClientSecretJWT   = "client_secret_jwt"
+	PrivateKeyJWT     = "private_key_jwt"
+	None              = "none"
+)
+
+// ClientAssertionType is the client_assertion_type of JWT client assertions
+// (rfc7523 section 2.2)
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientCredentials are the credentials presented by a client along with the
+// authentication method they belong to
+type clientCredentials struct {
+	method    string
+	id        string
+	secret    string
+	assertion string
+}
+
+// clientAuthenticators verify the credentials presented with each supported
+// client authentication method
+var clientAuthenticators = map[string]func(*context, *Client, *clientCredentials) (bool, error){
+	ClientSecretBasic:       authenticateWithSecret,
+	ClientSecretPost:        authenticateWithSecret,
+	ClientSecretJWT:         authenticateWithAssertion,
+	PrivateKeyJWT:           authenticateWithAssertion,
+	None:                    authenticateWithoutSecret,
+	TLSClientAuth:           authenticateWithCertificate,
+	SelfSignedTLSClientAuth: authenticateWithCertificate,
+}
+
+// AllowsAuthMethod determines if a client may authenticate at the token
+// endpoint with a method. Public clients may only use the none method while
+// confidential clients that have not registered a method may use either form of
+// client secret authentication.
+func (c *Client) AllowsAuthMethod(method string) bool {
+	if c.IsPublic() || method == None {
+		return c.IsPublic() && method == None
+	}
+	if c.TokenEndpointAuthMethod == "" {
+		return method == ClientSecretBasic || method == ClientSecretPost
+	}
+	return c.TokenEndpointAuthMethod == method
+}
+
+// presentedCredentials finds the credentials sent with a request. Requests
+// that use more than one method are rejected as rfc6749 section 2.3 requires.
+func presentedCredentials(ctx *context) (*clientCredentials, bool) {
+	f := ctx.request.PostForm
+	found := []*clientCredentials{}
+
+	if id, secret, ok := ctx.request.BasicAuth(); ok {
+		// credentials are form encoded before being placed in the header
+		uid, err1 := url.QueryUnescape(id)
+		usecret, err2 := url.QueryUnescape(secret)
+		if err1 != nil || err2 != nil {
+			return nil, false
+		}
+		found = append(found, &clientCredentials{method: ClientSecretBasic, id: uid, secret: usecret})
+	}
+	if f.Get("client_secret") != "" {
+		found = append(found, &clientCredentials{method: ClientSecretPost, id: f.Get("client_id"), secret: f.Get("client_secret")})
+	}
+	if f.Get("client_assertion_type") == ClientAssertionType {
+		cc := &clientCredentials{method: PrivateKeyJWT, id: f.Get("client_id"), assertion: f.Get("client_assertion")}
+		parts := strings.Split(cc.assertion, ".")
+		if len(parts) != 3 {
+			return nil, false
+		}
+		header, err := decodeSegment(parts[0])
+		if err != nil {
+			return nil, false
+		}
+		claims, err := decodeSegment(parts[1])
+		if err != nil {
+			return nil, false
+		}
+		// assertions signed with the client secret use an HMAC algorithm
+		if strings.HasPrefix(claimString(header, "alg"), "HS") {
+			cc.method = ClientSecretJWT
+		}
+		if cc.id == "" {
+			cc.id = claimString(claims, "sub")
+		}
+		found = append(found, cc)
+	}
+
+	// a client_id alone identifies a public client or a client that
+	// authenticates with its TLS certificate
+	if len(found) == 0 && f.Get("client_id") != "" {
+		found = append(found, &clientCredentials{method: None, id: f.Get("client_id")})
+	}
+
+	if len(found) != 1 {
+		return nil, false
+	}
+	if f.Get("client_id") != "" && f.Get("client_id") != found[0].id {
+		return nil, false
+	}
+	return found[0], true
+}
+
+func authenticateWithSecret(ctx *context, c *Client, cc *clientCredentials) (bool, error) {
+	return c.Secret != "" && subtle.ConstantTimeCompare([]byte(cc.secret), []byte(c.Secret)) == 1, nil
+}
+
+// authenticateWithoutSecret accepts public clients which only identify
+// themselves. Their requests must be bound by other means such as PKCE.
+func authenticateWithoutSecret(ctx *context, c *Client, cc *clientCredentials) (bool, error) {
+	return c.IsPublic(), nil
+}
+
+// authenticateWithAssertion verifies a client assertion whose issuer and
+// subject must both be the client. Assertions are signed with the client
+// secret for client_secret_jwt or with a registered key for private_key_jwt.
+func authenticateWithAssertion(ctx *context, c *Client, cc *clientCredentials) (bool, error) {
+	a, err := verifyAssertion(ctx, cc.assertion, func(iss, kid string) (interface{}, error) {
+		if iss != c.ID {
+			return nil, fmt.Errorf("assertion was not issued by the client")
+		}
+		if cc.method == ClientSecretJWT {
+			if c.Secret == "" {
+				return nil, fmt.Errorf("client does not have a secret")
+			}
+			return []byte(c.Secret), nil
+		}
+		return jwksKey(c.JWKS, kid)
+	})
+	if err != nil {
+		return false, err
+	}
+	return a != nil && a.Subject == c.ID, nil
+}
+
+// authenticateClient identifies and authenticates the client calling one of
+// the provider's back-channel endpoints. A nil client is returned if the client
+// is unknown or inactive, used a method it is not registered for or presented
+// invalid credentials.
+func (c *context) authenticateClient() (*Client, error) {
+	cc, ok := presentedCredentials(c)
+	if !ok {
+		return nil, nil
+	}
+	client, err := c.provider.Store.FetchClient(cc.id)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, nil
+	}
+	if m := client.TokenEndpointAuthMethod; cc.method == None && (m == TLSClientAuth || m == SelfSignedTLSClientAuth) {
+		cc.method = m
+	}
+	if client.Status != ClientActive || !client.AllowsAuthMethod(cc.method) {
+		return nil, nil
+	}
+	authenticate, found := clientAuthenticators[cc.method]
+	if !found {
+		return nil, nil
+	}
+	ok, err = authenticate(c, client, cc)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return client, nil
+}
+
+// failClientAuth responds to a request whose client could not be
+// authenticated as described in rfc6749 section 5.2
+func (c *context) failClientAuth() {
+	if c.request.Header.Get("Authorization") != "" {
+		c.writer.Header().Set("WWW-Authenticate", `Basic realm="`+c.provider.URL.Host+`"`)
+	}
+	c.json(http.StatusUnauthorized, ErrClientAuthFailed)
+}
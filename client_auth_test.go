@@ -0,0 +1,90 @@
+package ohauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestAuthenticateClient(t *testing.T) {
+	key, k := newAssertionKey(t)
+	legacy := NewClient("Legacy Client", ClientCredentials)
+	secretJWT := NewClient("Secret JWT Client", ClientCredentials)
+	secretJWT.TokenEndpointAuthMethod = ClientSecretJWT
+	keyJWT := NewClient("Private Key JWT Client", ClientCredentials)
+	keyJWT.TokenEndpointAuthMethod = PrivateKeyJWT
+	keyJWT.JWKS = &JWKSet{Keys: []*JWK{k}}
+	public := NewPublicClient("Public Client", AuthorizationCode)
+	for _, c := range []*Client{legacy, secretJWT, keyJWT, public} {
+		c.Status = ClientActive
+		if err := testProvider.Store.CreateClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claims := func(c *Client) map[string]interface{} {
+		return map[string]interface{}{
+			"iss": c.ID,
+			"sub": c.ID,
+			"aud": testProvider.endpoint("/token"),
+			"exp": time.Now().Add(time.Minute).Unix(),
+			"jti": randID(),
+		}
+	}
+	hmacAssertion := signAssertion(t, jwt.SigningMethodHS256, []byte(secretJWT.Secret), nil, claims(secretJWT))
+	keyAssertion := signAssertion(t, jwt.SigningMethodES256, key, nil, claims(keyJWT))
+
+	table := []struct {
+		name     string
+		basic    []string
+		form     url.Values
+		expected *Client
+	}{
+		{"basic", []string{legacy.ID, legacy.Secret}, url.Values{}, legacy},
+		{"basic wrong secret", []string{legacy.ID, "wrong"}, url.Values{}, nil},
+		{"post", nil, url.Values{"client_id": {legacy.ID}, "client_secret": {legacy.Secret}}, legacy},
+		{"basic and post", []string{legacy.ID, legacy.Secret}, url.Values{"client_id": {legacy.ID}, "client_secret": {legacy.Secret}}, nil},
+		{"none", nil, url.Values{"client_id": {public.ID}}, public},
+		{"none for confidential client", nil, url.Values{"client_id": {legacy.ID}}, nil},
+		{"public client with secret", nil, url.Values{"client_id": {public.ID}, "client_secret": {"secret"}}, nil},
+		{"unregistered method", nil, url.Values{"client_id": {secretJWT.ID}, "client_secret": {secretJWT.Secret}}, nil},
+		{"client secret jwt", nil, url.Values{"client_assertion_type": {ClientAssertionType}, "client_assertion": {hmacAssertion}}, secretJWT},
+		{"private key jwt", nil, url.Values{"client_assertion_type": {ClientAssertionType}, "client_assertion": {keyAssertion}}, keyJWT},
+		{"replayed assertion", nil, url.Values{"client_assertion_type": {ClientAssertionType}, "client_assertion": {keyAssertion}}, nil},
+		{"key signed with secret", nil, url.Values{
+			"client_assertion_type": {ClientAssertionType},
+			"client_assertion":      {signAssertion(t, jwt.SigningMethodHS256, []byte(keyJWT.Secret), nil, claims(keyJWT))},
+		}, nil},
+	}
+
+	for _, r := range table {
+		req := httptest.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(r.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if r.basic != nil {
+			req.SetBasicAuth(url.QueryEscape(r.basic[0]), url.QueryEscape(r.basic[1]))
+		}
+		if err := req.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		ctx := &context{testProvider, w, req, time.Now()}
+		c, err := ctx.authenticateClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != r.expected {
+			t.Fatalf("%s: EXPECTED = %v - GOT = %v", r.name, r.expected, c)
+		}
+		if c == nil {
+			ctx.failClientAuth()
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("%s: EXPECTED = %d - GOT = %d", r.name, http.StatusUnauthorized, w.Code)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"time"
 )
@@ -15,35 +16,233 @@ const (
 	ClientRevoked = "revoked"
 )
 
+// possible values for client type (rfc6749 section 2.1)
+const (
+	ConfidentialClient = "confidential"
+	PublicClient       = "public"
+)
+
+// possible values for client application type (openid connect dynamic client
+// registration section 2)
+const (
+	WebApplication    = "web"
+	NativeApplication = "native"
+)
+
 // Client defines an OAuth 2.0 client
 type Client struct {
 	ID          string `json:"id"`
 	DisplayName string `json:"displayName"`
 	Secret      string `json:"secret"`
+	// Type is either ConfidentialClient or PublicClient. Public clients have no
+	// secret and authenticate with the none method. An empty Type means
+	// ConfidentialClient.
+	Type string `json:"type,omitempty"`
 
-	// GrantType defines the allowed flow the client may use
-	GrantType   string     `json:"grantType"`
-	RedirectURI *StrictURL `json:"redirectURI"`
-	Scope       Scope      `json:"scope"`
-	Status      string     `json:"status"`
-	Created     time.Time  `json:"created"`
+	// GrantTypes and ResponseTypes define the flows the client may use
+	GrantTypes    []string  `json:"grantTypes"`
+	ResponseTypes []string  `json:"responseTypes"`
+	Scope         Scope     `json:"scope"`
+	Status        string    `json:"status"`
+	Created       time.Time `json:"created"`
+
+	// RedirectURIs are the registered redirect uris which are matched against
+	// the one in an authorization request using RedirectMatching. An empty
+	// RedirectMatching means RedirectExact.
+	RedirectURIs     []*StrictURL `json:"redirectURIs"`
+	RedirectMatching string       `json:"redirectMatching,omitempty"`
+
+	// ApplicationType selects the RedirectPolicy for the client's redirect
+	// uris. An empty ApplicationType means WebApplication.
+	ApplicationType string `json:"applicationType,omitempty"`
+
+	// TokenEndpointAuthMethod is the method the client uses to authenticate
+	// with the provider. When empty the client secret may be sent using HTTP
+	// Basic authentication or in the request body.
+	TokenEndpointAuthMethod string `json:"tokenEndpointAuthMethod,omitempty"`
+
+	// RequirePKCE forces the client to send a code challenge with every
+	// authorization code request. It is always required of public clients.
+	RequirePKCE bool `json:"requirePKCE"`
+	// RequireDPoP forces the client to send a DPoP proof with every token
+	// request so that its access tokens are always bound to a key
+	RequireDPoP bool `json:"requireDPoP,omitempty"`
+	// RequirePushedRequests only allows the client to make authorization
+	// requests that were pushed to the provider beforehand
+	RequirePushedRequests bool `json:"requirePushedRequests,omitempty"`
+	// RequireSignedRequests only allows the client to make authorization
+	// requests using signed request objects
+	RequireSignedRequests bool `json:"requireSignedRequests,omitempty"`
+	// FirstParty marks a client operated by the provider itself which may be
+	// issued scopes restricted to first-party clients. Dynamically registered
+	// clients are never first-party.
+	FirstParty bool `json:"firstParty,omitempty"`
+	// RequestURIs lists the urls the provider may fetch the client's request
+	// objects from
+	RequestURIs []string `json:"requestURIs,omitempty"`
+	// AuthorizationDetailTypes restricts the types of authorization details
+	// the client may request. Any type registered with the provider may be
+	// requested if it is empty.
+	AuthorizationDetailTypes []string `json:"authorizationDetailTypes,omitempty"`
+	// BackchannelDeliveryMode is the mode, poll, ping or push, in which the
+	// client receives the outcome of backchannel authentication requests at
+	// its BackchannelNotificationEndpoint. An empty mode means DeliveryPoll.
+	BackchannelDeliveryMode         string `json:"backchannelDeliveryMode,omitempty"`
+	BackchannelNotificationEndpoint string `json:"backchannelNotificationEndpoint,omitempty"`
 
 	// Keys are used with a Tokenizer to sign and verify codes and tokens
 	Keys *ClientKeys `json:"keys"`
+	// JWKS holds public keys registered by the client itself
+	JWKS *JWKSet `json:"jwks,omitempty"`
+	// TLSSubjectDN and TLSSANDNS identify the certificate of a client using the
+	// tls_client_auth method. Only one of them should be set.
+	TLSSubjectDN string `json:"tlsSubjectDN,omitempty"`
+	TLSSANDNS    string `json:"tlsSANDNS,omitempty"`
+	// RegistrationHash is a hash of the registration access token that allows
+	// a dynamically registered client to manage its own registration
+	RegistrationHash string `json:"registrationHash,omitempty"`
 }
 
-// NewClient creates a default client with randomly generated id, secret and keys.
-// The default client's scope is empty initially as well.
-func NewClient(displayName string, grantType string) *Client {
+// NewClient creates a default client with randomly generated id, secret and keys
+// that may use the specified grant types. The response types matching the
+// grant types are allowed as well and clients using authorization codes or
+// passwords may also use refresh tokens. The default client's scope is empty
+// initially.
+func NewClient(displayName string, grantTypes ...string) *Client {
+	gts := grantsWithRefresh(grantTypes)
 	return &Client{
-		ID:          randID(),
-		DisplayName: displayName,
-		GrantType:   grantType,
-		Created:     time.Now(),
-		Secret:      base64.URLEncoding.EncodeToString(randBytes(30)),
-		Keys:        NewClientKeys(),
-		Scope:       ParseScope(""),
+		ID:            randID(),
+		DisplayName:   displayName,
+		GrantTypes:    gts,
+		ResponseTypes: responseTypesFor(gts),
+		Created:       time.Now(),
+		Secret:        newClientSecret(),
+		Keys:          NewClientKeys(),
+		Scope:         ParseScope(""),
+	}
+}
+
+func newClientSecret() string {
+	return base64.URLEncoding.EncodeToString(randBytes(30))
+}
+
+// NewPublicClient creates a client like NewClient that is a public client
+// without a secret
+func NewPublicClient(displayName string, grantTypes ...string) *Client {
+	c := NewClient(displayName, grantTypes...)
+	c.Type = PublicClient
+	c.Secret = ""
+	c.TokenEndpointAuthMethod = None
+	return c
+}
+
+// IsPublic determines if a client is a public client
+func (c *Client) IsPublic() bool {
+	return c.Type == PublicClient
+}
+
+// response types that the authorization endpoint uses for each grant type
+var grantResponseTypes = map[string]string{
+	AuthorizationCode: "code",
+	Implicit:          "token",
+}
+
+// responseGrant returns the grant type a response type is issued under
+func responseGrant(responseType string) string {
+	for gt, rt := range grantResponseTypes {
+		if rt == responseType {
+			return gt
+		}
+	}
+	return ""
+}
+
+// grantsWithRefresh adds the refresh token grant to grant types that have
+// always come with refresh tokens
+func grantsWithRefresh(grantTypes []string) []string {
+	if containsString(grantTypes, AuthorizationCode) || containsString(grantTypes, Password) {
+		grantTypes = append(grantTypes[:len(grantTypes):len(grantTypes)], RefreshToken)
+	}
+	return uniqueStrings(grantTypes)
+}
+
+func responseTypesFor(grantTypes []string) []string {
+	out := []string{}
+	for _, gt := range grantTypes {
+		if rt, found := grantResponseTypes[gt]; found {
+			out = append(out, rt)
+		}
+	}
+	return out
+}
+
+func uniqueStrings(in []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, v := range in {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsGrant determines if a client is registered for a grant type
+func (c *Client) AllowsGrant(grantType string) bool {
+	return containsString(c.GrantTypes, grantType)
+}
+
+// AllowsResponseType determines if a client is registered for a response type
+func (c *Client) AllowsResponseType(responseType string) bool {
+	return containsString(c.ResponseTypes, responseType)
+}
+
+// DeliveryMode returns the client's backchannel token delivery mode
+func (c *Client) DeliveryMode() string {
+	if c.BackchannelDeliveryMode == "" {
+		return DeliveryPoll
+	}
+	return c.BackchannelDeliveryMode
+}
+
+// AllowsAuthorizationDetailType determines if a client may request
+// authorization details of a type
+func (c *Client) AllowsAuthorizationDetailType(t string) bool {
+	return len(c.AuthorizationDetailTypes) == 0 || containsString(c.AuthorizationDetailTypes, t)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. Clients stored
+// before they could hold several grant types carry a single grantType which is
+// converted along with the refresh token grant those clients were allowed.
+// Likewise a single redirectURI becomes the only registered redirect uri.
+func (c *Client) UnmarshalJSON(b []byte) error {
+	type client Client
+	aux := &struct {
+		*client
+		GrantType   string     `json:"grantType"`
+		RedirectURI *StrictURL `json:"redirectURI"`
+	}{client: (*client)(c)}
+	if err := json.Unmarshal(b, aux); err != nil {
+		return err
+	}
+	if aux.RedirectURI != nil && len(c.RedirectURIs) == 0 {
+		c.RedirectURIs = []*StrictURL{aux.RedirectURI}
+	}
+	if aux.GrantType != "" && len(c.GrantTypes) == 0 {
+		c.GrantTypes = grantsWithRefresh([]string{aux.GrantType})
+		c.ResponseTypes = responseTypesFor(c.GrantTypes)
 	}
+	return nil
 }
 
 // ClientKeys are used in conjuction with Tokenizers to sign and verify codes
@@ -88,10 +287,13 @@ type Authorization struct {
 	Scope   Scope     `json:"scope"`
 	Active  bool      `json:"active"`
 	Created time.Time `json:"created"`
+	// Details are the authorization details (rfc9396) the resource owner
+	// approved along with the scope
+	Details AuthorizationDetails `json:"details,omitempty"`
 }
 
 // NewAuthorization initialises an authorization with a specified client id,
 // resource owner id and scope that may be saved to a store.
 func NewAuthorization(cid, uid string, scope Scope) *Authorization {
-	return &Authorization{cid, uid, scope, true, time.Now()}
+	return &Authorization{cid, uid, scope, true, time.Now(), nil}
 }
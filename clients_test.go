@@ -0,0 +1,53 @@
+package ohauth
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestClient_legacyGrantType(t *testing.T) {
+	table := []struct {
+		grantType string
+		refresh   bool
+		code      bool
+	}{
+		{AuthorizationCode, true, true},
+		{Password, true, false},
+		{ClientCredentials, false, false},
+	}
+	for _, r := range table {
+		c := &Client{}
+		if err := json.Unmarshal([]byte(`{"id": "legacy", "grantType": "`+r.grantType+`"}`), c); err != nil {
+			t.Fatal(err)
+		}
+		if !c.AllowsGrant(r.grantType) || c.AllowsGrant(RefreshToken) != r.refresh || c.AllowsResponseType("code") != r.code {
+			t.Fatalf("%s: client was not converted: %+v", r.grantType, c)
+		}
+	}
+
+	c := &Client{}
+	if err := json.Unmarshal([]byte(`{"grantType": "password", "grantTypes": ["client_credentials"]}`), c); err != nil {
+		t.Fatal(err)
+	}
+	if c.AllowsGrant(Password) || !c.AllowsGrant(ClientCredentials) {
+		t.Fatalf("grantTypes should take precedence: %+v", c)
+	}
+}
+
+func TestNewClient_refreshToken(t *testing.T) {
+	table := []struct {
+		grantTypes []string
+		refresh    bool
+	}{
+		{[]string{AuthorizationCode}, true},
+		{[]string{Password}, true},
+		{[]string{ClientCredentials}, false},
+		{[]string{DeviceCode}, false},
+	}
+	for _, r := range table {
+		c := NewClient("Test Client", r.grantTypes...)
+		if c.AllowsGrant(RefreshToken) != r.refresh {
+			t.Fatalf("%v: EXPECTED = %t - GOT = %t", r.grantTypes, r.refresh, c.AllowsGrant(RefreshToken))
+		}
+	}
+}
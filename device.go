@@ -0,0 +1,95 @@
+package ohauth
+
+import (
+	"strings"
+	"time"
+)
+
+// possible values for device authorization status
+const (
+	DevicePending  = "pending"
+	DeviceApproved = "approved"
+	DeviceDenied   = "denied"
+	DeviceRedeemed = "redeemed"
+)
+
+// default and slow down increment of the polling interval in rfc8628
+const (
+	devicePollInterval = 5 * time.Second
+	deviceSlowDown     = 5 * time.Second
+)
+
+// user codes avoid vowels and look-alike characters (rfc8628 section 6.1)
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+// DeviceAuthorization tracks a device authorization request (rfc8628) from the
+// moment a device code is issued until it is redeemed for tokens
+type DeviceAuthorization struct {
+	DeviceCode string        `json:"deviceCode"`
+	UserCode   string        `json:"userCode"`
+	CID        string        `json:"cid"`
+	UID        string        `json:"uid"`
+	Scope      Scope         `json:"scope"`
+	Status     string        `json:"status"`
+	Interval   time.Duration `json:"interval"`
+	LastPolled time.Time     `json:"lastPolled"`
+	Expires    time.Time     `json:"expires"`
+	Created    time.Time     `json:"created"`
+	// ConfirmToken is handed to the resource owner named by UID along with
+	// the dialog and must be posted back with their decision
+	ConfirmToken string `json:"confirmToken"`
+}
+
+// NewDeviceAuthorization creates a pending device authorization with random
+// device and user codes
+func NewDeviceAuthorization(cid string, scope Scope, iat, exp time.Time) *DeviceAuthorization {
+	return &DeviceAuthorization{
+		DeviceCode: randToken(),
+		UserCode:   randUserCode(),
+		CID:        cid,
+		Scope:      scope,
+		Status:     DevicePending,
+		Interval:   devicePollInterval,
+		Expires:    exp,
+		Created:    iat,
+	}
+}
+
+// randUserCode picks every character of a user code uniformly from the
+// charset. Random bytes at or above the largest multiple of the charset's
+// length are rejected since they would favour the first characters.
+func randUserCode() string {
+	limit := 256 - 256%len(userCodeCharset)
+	out := make([]byte, 0, 9)
+	for len(out) < 9 {
+		for _, v := range randBytes(8) {
+			if len(out) == 9 {
+				break
+			}
+			if int(v) >= limit {
+				continue
+			}
+			if len(out) == 4 {
+				out = append(out, '-')
+			}
+			out = append(out, userCodeCharset[int(v)%len(userCodeCharset)])
+		}
+	}
+	return string(out)
+}
+
+// NormalizeUserCode converts a user code typed by a resource owner into the
+// form it was issued in by ignoring case, spaces and dashes
+func NormalizeUserCode(raw string) string {
+	raw = strings.ToUpper(raw)
+	clean := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if strings.IndexByte(userCodeCharset, raw[i]) >= 0 {
+			clean = append(clean, raw[i])
+		}
+	}
+	if len(clean) != 8 {
+		return string(clean)
+	}
+	return string(clean[:4]) + "-" + string(clean[4:])
+}
@@ -0,0 +1,211 @@
+package ohauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DPoP proof JWT type and the token type of DPoP-bound access tokens (rfc9449)
+const (
+	DPoPProofType = "dpop+jwt"
+	DPoPTokenType = "DPoP"
+)
+
+// dpopAlgs lists the asymmetric JWS algorithms accepted for DPoP proofs
+var dpopAlgs = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512"}
+
+// proofs are accepted for a short time after they are created and allow for
+// a little clock skew. Nonces change with every window and the previous one
+// is still accepted.
+const (
+	dpopProofAge   = 5 * time.Minute
+	dpopClockSkew  = time.Minute
+	dpopNonceAfter = 5 * time.Minute
+)
+
+// DPoPPolicy may be implemented by an Issuer to require DPoP proofs sent to the
+// token endpoint to carry a nonce provided by the provider (rfc9449 section 8).
+// Without it nonces are provided but only checked when a proof includes one.
+type DPoPPolicy interface {
+	// RequireDPoPNonce determines if proofs from a client must carry a nonce
+	RequireDPoPNonce(client *Client) bool
+}
+
+// dpopProof holds a DPoP proof whose signature has been verified with the
+// public key in its header
+type dpopProof struct {
+	ID         string
+	Thumbprint string
+	Issued     time.Time
+	claims     map[string]interface{}
+}
+
+// requestURL reconstructs the url of a request without its query and fragment
+func requestURL(r *http.Request) string {
+	u := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+// parseDPoPProof verifies the signature of the single DPoP proof sent with a
+// request and checks its typ, jwk, htm, htu, iat and jti values (rfc9449
+// section 4.3). Replay and nonce checks are left to the caller. A nil proof is
+// returned if the request has no valid proof.
+func parseDPoPProof(r *http.Request, htu string, now time.Time) *dpopProof {
+	if len(r.Header[http.CanonicalHeaderKey("DPoP")]) != 1 {
+		return nil
+	}
+	proof := &dpopProof{}
+	claims, err := parseSignedClaims(r.Header.Get("DPoP"), func(header, claims map[string]interface{}) (interface{}, error) {
+		if claimString(header, "typ") != DPoPProofType || !containsString(dpopAlgs, claimString(header, "alg")) {
+			return nil, ErrUnsupportedKey
+		}
+		jwk, ok := header["jwk"].(map[string]interface{})
+		if !ok || jwk["d"] != nil {
+			return nil, ErrUnsupportedKey
+		}
+		b, err := json.Marshal(jwk)
+		if err != nil {
+			return nil, err
+		}
+		k := &JWK{}
+		if err := json.Unmarshal(b, k); err != nil {
+			return nil, err
+		}
+		proof.Thumbprint = k.Thumbprint()
+		return k.PublicKey()
+	})
+	if err != nil {
+		return nil
+	}
+	proof.ID = claimString(claims, "jti")
+	proof.claims = claims
+
+	u, err := url.Parse(claimString(claims, "htu"))
+	if err != nil {
+		return nil
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	iat, ok := claimTime(claims, "iat")
+	if !ok || iat.Before(now.Add(-dpopProofAge)) || iat.After(now.Add(dpopClockSkew)) {
+		return nil
+	}
+	proof.Issued = iat
+	if proof.ID == "" || claimString(claims, "htm") != r.Method || u.String() != htu {
+		return nil
+	}
+	return proof
+}
+
+// replayed records the proof so that it cannot be used again and reports
+// whether it had already been used. It only needs to be remembered for as
+// long as it would be accepted.
+func (d *dpopProof) replayed(store Store) (bool, error) {
+	return replayed(store, "dpop:"+d.Thumbprint+":"+d.ID, d.Issued.Add(dpopProofAge))
+}
+
+// dpopNonce creates the nonce for a window of time. Nonces are derived from the
+// provider keys so they do not need to be stored.
+func (p *Provider) dpopNonce(window int64) string {
+	w := strconv.FormatInt(window, 10)
+	mac := hmac.New(sha256.New, p.Keys.Sign)
+	mac.Write([]byte("dpop-nonce:" + w))
+	return w + "." + b64.EncodeToString(mac.Sum(nil))
+}
+
+func (p *Provider) validDPoPNonce(nonce string, now time.Time) bool {
+	window := now.Unix() / int64(dpopNonceAfter/time.Second)
+	for _, w := range []int64{window, window - 1} {
+		if hmac.Equal([]byte(nonce), []byte(p.dpopNonce(w))) {
+			return true
+		}
+	}
+	return false
+}
+
+// dpopBinding verifies the DPoP proof sent to the token endpoint by a client
+// and returns the thumbprint of the proof key. An empty thumbprint is returned
+// when the client did not send a proof and is not required to. The DPoP-Nonce
+// header is set on every response to a request with a proof.
+func (c *context) dpopBinding(client *Client) (string, *Error, error) {
+	p := c.provider
+	if c.request.Header.Get("DPoP") == "" {
+		if client.RequireDPoP {
+			return "", ErrBadDPoPProof, nil
+		}
+		return "", nil, nil
+	}
+	if p.Keys != nil {
+		c.writer.Header().Set("DPoP-Nonce", p.dpopNonce(c.timestamp.Unix()/int64(dpopNonceAfter/time.Second)))
+	}
+
+	proof := parseDPoPProof(c.request, p.endpoint("/token"), c.timestamp)
+	if proof == nil {
+		return "", ErrBadDPoPProof, nil
+	}
+	nonce := claimString(proof.claims, "nonce")
+	policy, ok := p.Issuer.(DPoPPolicy)
+	required := ok && policy.RequireDPoPNonce(client)
+	// nonces are derived from the provider keys and cannot be issued or
+	// verified without them
+	if p.Keys == nil {
+		if required {
+			return "", nil, ErrNoProviderKeys
+		}
+		nonce = ""
+	}
+	if (required || nonce != "") && !p.validDPoPNonce(nonce, c.timestamp) {
+		return "", ErrDPoPNonceRequired, nil
+	}
+	used, err := proof.replayed(p.Store)
+	if err != nil {
+		return "", nil, err
+	}
+	if used {
+		return "", ErrBadDPoPProof, nil
+	}
+	return proof.Thumbprint, nil, nil
+}
+
+// VerifyDPoP verifies the DPoP proof sent to a resource server along with a
+// DPoP-bound access token (rfc9449 section 7). The claims must be those of the
+// access token in the request's Authorization header and the store is used to
+// reject replayed proofs. False is returned if the token is not bound to the
+// key of a valid proof.
+func VerifyDPoP(r *http.Request, tc *TokenClaims, store Store) (bool, error) {
+	if tc == nil || tc.Confirmation == nil || tc.Confirmation.JWKThumbprint == "" {
+		return false, nil
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, DPoPTokenType+" ") {
+		return false, nil
+	}
+	proof := parseDPoPProof(r, requestURL(r), time.Now())
+	if proof == nil || proof.Thumbprint != tc.Confirmation.JWKThumbprint {
+		return false, nil
+	}
+	if claimString(proof.claims, "ath") != tokenHash256(strings.TrimPrefix(auth, DPoPTokenType+" ")) {
+		return false, nil
+	}
+	used, err := proof.replayed(store)
+	if err != nil || used {
+		return false, err
+	}
+	return true, nil
+}
+
+// tokenHash256 is the ath value of a DPoP proof, the base64url encoded SHA-256
+// hash of an access token
+func tokenHash256(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return b64.EncodeToString(sum[:])
+}
@@ -0,0 +1,164 @@
+package ohauth
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type nonceIssuer struct {
+	defaultIssuer
+}
+
+func (*nonceIssuer) RequireDPoPNonce(*Client) bool {
+	return true
+}
+
+func signProof(t *testing.T, key *ecdsa.PrivateKey, k *JWK, htm, htu string, extra map[string]interface{}) string {
+	claims := map[string]interface{}{"htm": htm, "htu": htu, "iat": time.Now().Unix(), "jti": randID()}
+	for name, v := range extra {
+		claims[name] = v
+	}
+	return signAssertion(t, jwt.SigningMethodES256, key, map[string]interface{}{"typ": DPoPProofType, "jwk": k}, claims)
+}
+
+func postDPoPGrant(t *testing.T, p *Provider, form url.Values, proof string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	r := httptest.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if proof != "" {
+		r.Header.Set("DPoP", proof)
+	}
+	w := httptest.NewRecorder()
+	if err := handleGrant(&context{p, w, r, time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return w, out
+}
+
+func TestGrant_dpop(t *testing.T) {
+	key, k := newAssertionKey(t)
+	client := NewClient("Test Client", Password)
+	client.Scope = ParseScope("email")
+	client.Status = ClientActive
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{
+		"grant_type":    {Password},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"username":      {"testuser"},
+		"password":      {"testpassword"},
+		"scope":         {"email"},
+	}
+	htu := testProvider.endpoint("/token")
+
+	proof := signProof(t, key, k, "POST", htu, nil)
+	w, out := postDPoPGrant(t, testProvider, form, proof)
+	if w.Code != http.StatusOK || out["token_type"] != DPoPTokenType || w.Header().Get("DPoP-Nonce") == "" {
+		t.Fatalf("EXPECTED DPoP token - GOT = %d %v", w.Code, out)
+	}
+	at, err := testProvider.Tokenizer.Parse(out["access_token"].(string), client.Keys.Verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at.Confirmation == nil || at.Confirmation.JWKThumbprint != k.Thumbprint() {
+		t.Fatalf("access token was not bound to the proof key: %+v", at.Confirmation)
+	}
+
+	table := []struct {
+		name  string
+		proof string
+		code  string
+	}{
+		{"replayed", proof, InvalidDPoPProof},
+		{"wrong method", signProof(t, key, k, "GET", htu, nil), InvalidDPoPProof},
+		{"wrong url", signProof(t, key, k, "POST", "https://other.example.com/token", nil), InvalidDPoPProof},
+		{"expired", signProof(t, key, k, "POST", htu, map[string]interface{}{"iat": time.Now().Add(-time.Hour).Unix()}), InvalidDPoPProof},
+		{"bad nonce", signProof(t, key, k, "POST", htu, map[string]interface{}{"nonce": "guess"}), UseDPoPNonce},
+		{"hmac", signAssertion(t, jwt.SigningMethodHS256, []byte("secret"), map[string]interface{}{"typ": DPoPProofType, "jwk": k}, map[string]interface{}{
+			"htm": "POST", "htu": htu, "iat": time.Now().Unix(), "jti": randID(),
+		}), InvalidDPoPProof},
+	}
+	for _, r := range table {
+		w, out := postDPoPGrant(t, testProvider, form, r.proof)
+		if w.Code != http.StatusBadRequest || out["error"] != r.code {
+			t.Fatalf("%s: EXPECTED = %s - GOT = %d %v", r.name, r.code, w.Code, out)
+		}
+	}
+
+	p := *testProvider
+	p.Issuer = &nonceIssuer{}
+	w, out = postDPoPGrant(t, &p, form, signProof(t, key, k, "POST", htu, nil))
+	if w.Code != http.StatusBadRequest || out["error"] != UseDPoPNonce {
+		t.Fatalf("proof without nonce: EXPECTED = %s - GOT = %d %v", UseDPoPNonce, w.Code, out)
+	}
+	nonce := w.Header().Get("DPoP-Nonce")
+	w, out = postDPoPGrant(t, &p, form, signProof(t, key, k, "POST", htu, map[string]interface{}{"nonce": nonce}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("proof with nonce: EXPECTED = %d - GOT = %d %v", http.StatusOK, w.Code, out)
+	}
+
+	// nonces cannot be issued without the provider keys
+	p = *testProvider
+	p.Keys = nil
+	w, out = postDPoPGrant(t, &p, form, signProof(t, key, k, "POST", htu, nil))
+	if w.Code != http.StatusOK || w.Header().Get("DPoP-Nonce") != "" {
+		t.Fatalf("proof without provider keys: EXPECTED = %d - GOT = %d %v", http.StatusOK, w.Code, out)
+	}
+	p.Issuer = &nonceIssuer{}
+	w, out = postDPoPGrant(t, &p, form, signProof(t, key, k, "POST", htu, nil))
+	if w.Code != http.StatusInternalServerError || out["error"] != ServerError {
+		t.Fatalf("required nonce without provider keys: EXPECTED = %s - GOT = %d %v", ServerError, w.Code, out)
+	}
+}
+
+func TestVerifyDPoP(t *testing.T) {
+	key, k := newAssertionKey(t)
+	token := "access-token"
+	tc := &TokenClaims{Confirmation: &Confirmation{JWKThumbprint: k.Thumbprint()}}
+	request := func(proof string) *http.Request {
+		r := httptest.NewRequest("GET", "https://api.example.com/orders?page=2", nil)
+		r.Header.Set("Authorization", DPoPTokenType+" "+token)
+		r.Header.Set("DPoP", proof)
+		return r
+	}
+
+	proof := signProof(t, key, k, "GET", "https://api.example.com/orders", map[string]interface{}{"ath": tokenHash256(token)})
+	table := []struct {
+		name     string
+		proof    string
+		expected bool
+	}{
+		{"valid", proof, true},
+		{"replayed", proof, false},
+		{"missing ath", signProof(t, key, k, "GET", "https://api.example.com/orders", nil), false},
+		{"other token", signProof(t, key, k, "GET", "https://api.example.com/orders", map[string]interface{}{"ath": tokenHash256("other")}), false},
+	}
+	for _, r := range table {
+		ok, err := VerifyDPoP(request(r.proof), tc, testProvider.Store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != r.expected {
+			t.Fatalf("%s: EXPECTED = %t - GOT = %t", r.name, r.expected, ok)
+		}
+	}
+
+	other, _ := newAssertionKey(t)
+	forged := signProof(t, other, k, "GET", "https://api.example.com/orders", map[string]interface{}{"ath": tokenHash256(token)})
+	if ok, _ := VerifyDPoP(request(forged), tc, testProvider.Store); ok {
+		t.Fatal("proof signed with another key was accepted")
+	}
+}
@@ -29,7 +29,7 @@ func (e *Error) Values() url.Values {
 	return v
 }
 
-// Error codes as specified throughout rfc6749
+// Error codes as specified throughout rfc6749 and its extensions
 const (
 	AccessDenied            = "access_denied"
 	InvalidClient           = "invalid_client"
@@ -41,6 +41,22 @@ const (
 	UnauthorizedClient      = "unauthorized_client"
 	UnsupportedGrantType    = "unsupported_grant_type"
 	UnsupportedResponseType = "unsupported_response_type"
+	UnsupportedTokenType    = "unsupported_token_type"
+	InvalidToken            = "invalid_token"
+	InvalidTarget           = "invalid_target"
+	AuthorizationPending    = "authorization_pending"
+	SlowDown                = "slow_down"
+	ExpiredToken            = "expired_token"
+	InvalidRequestObject    = "invalid_request_object"
+	InvalidDPoPProof        = "invalid_dpop_proof"
+	UseDPoPNonce            = "use_dpop_nonce"
+	InvalidAuthzDetails     = "invalid_authorization_details"
+	UnknownUserID           = "unknown_user_id"
+
+	InvalidRedirectURI          = "invalid_redirect_uri"
+	InvalidClientMetadata       = "invalid_client_metadata"
+	InvalidSoftwareStatement    = "invalid_software_statement"
+	UnapprovedSoftwareStatement = "unapproved_software_statement"
 )
 
 // Common errors that can occur while processing authorization and token
@@ -56,4 +72,42 @@ var (
 	ErrAccessDenied          = NewError(AccessDenied, "access denied")
 	ErrUnauthorized          = NewError(UnauthorizedClient, "unauthorized client")
 	ErrCodeUsed              = NewError(InvalidRequest, "authorization code has already been used")
+	ErrInvalidRefreshToken   = NewError(InvalidGrant, "refresh token is invalid, expired or revoked")
+	ErrChallengeRequired     = NewError(InvalidRequest, "code challenge required")
+	ErrInvalidChallenge      = NewError(InvalidRequest, "invalid code challenge or unsupported transform method")
+	ErrVerifierMismatch      = NewError(InvalidGrant, "code verifier does not match code challenge")
+	ErrClientAuthFailed      = NewError(InvalidClient, "client authentication failed")
+	ErrMissingToken          = NewError(InvalidRequest, "token parameter is required")
+	ErrUnsupportedTokenType  = NewError(UnsupportedTokenType, "token type cannot be revoked")
+	ErrBadAccessToken        = NewError(InvalidToken, "access token is missing or invalid")
+	ErrBadClientMetadata     = NewError(InvalidClientMetadata, "invalid client metadata")
+	ErrBadRegisteredRedirect = NewError(InvalidRedirectURI, "invalid or missing redirect uris")
+	ErrBadSoftwareStatement  = NewError(UnapprovedSoftwareStatement, "software statement could not be verified")
+	ErrDevicePending         = NewError(AuthorizationPending, "resource owner has not yet completed authorization")
+	ErrDeviceSlowDown        = NewError(SlowDown, "polling too frequently")
+	ErrDeviceExpired         = NewError(ExpiredToken, "device code has expired")
+	ErrDeviceCodeInvalid     = NewError(InvalidGrant, "device code is invalid or has already been used")
+	ErrUserCodeInvalid       = NewError(InvalidRequest, "user code is invalid or has expired")
+	ErrBadAssertion          = NewError(InvalidGrant, "assertion is invalid, expired or has already been used")
+	ErrBadExchangeTokenType  = NewError(InvalidRequest, "unsupported token type for token exchange")
+	ErrBadSubjectToken       = NewError(InvalidGrant, "subject token is invalid or inactive")
+	ErrBadActorToken         = NewError(InvalidGrant, "actor token is invalid or inactive")
+	ErrBadTarget             = NewError(InvalidTarget, "requested audience is unknown")
+	ErrScopeExceedsGrant     = NewError(InvalidScope, "requested scope exceeds the scope originally granted")
+	ErrBadDPoPProof          = NewError(InvalidDPoPProof, "invalid dpop proof")
+	ErrDPoPNonceRequired     = NewError(UseDPoPNonce, "dpop proof must use the nonce provided by the server")
+	ErrPushedRequestRequired = NewError(InvalidRequest, "authorization request must be pushed to the provider first")
+	ErrBadPushedRequest      = NewError(InvalidRequest, "invalid pushed authorization request")
+	ErrBadRequestObject      = NewError(InvalidRequestObject, "request object is invalid or cannot be verified")
+	ErrSignedRequestRequired = NewError(InvalidRequest, "authorization request must use a signed request object")
+	ErrBadAuthzDetails       = NewError(InvalidAuthzDetails, "authorization details are invalid or not allowed")
+	ErrDetailsExceedGrant    = NewError(InvalidAuthzDetails, "requested authorization details exceed those originally granted")
+	ErrBadResource           = NewError(InvalidTarget, "requested resource is invalid or unknown")
+	ErrAmbiguousResource     = NewError(InvalidTarget, "a token can only be issued for a single resource")
+	ErrBadLoginHint          = NewError(InvalidRequest, "exactly one of login_hint, login_hint_token and id_token_hint is required")
+	ErrUnknownUser           = NewError(UnknownUserID, "login hint does not identify a known user")
+	ErrNotificationToken     = NewError(InvalidRequest, "client notification token is required")
+	ErrBadRequestedExpiry    = NewError(InvalidRequest, "requested expiry must be a positive number of seconds")
+	ErrBadAuthReqID          = NewError(InvalidGrant, "auth_req_id is invalid or has already been used")
+	ErrAuthReqExpired        = NewError(ExpiredToken, "backchannel authentication request has expired")
 )
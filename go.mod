@@ -0,0 +1,10 @@
+module github.com/disintegrator/ohauth
+
+go 1.16
+
+// jwt-go is pinned to v2 since the tokenizers rely on its map claims and PEM
+// encoded keys, which v3 no longer accepts
+require (
+	github.com/dgrijalva/jwt-go v2.7.0+incompatible
+	github.com/mitchellh/mapstructure v1.5.0
+)
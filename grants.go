@@ -8,3 +8,17 @@ const (
 	ClientCredentials = "client_credentials"
 	RefreshToken      = "refresh_token"
 )
+
+// Extension grant types
+const (
+	DeviceCode    = "urn:ietf:params:oauth:grant-type:device_code"
+	JWTBearer     = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	TokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	CIBA          = "urn:openid:params:grant-type:ciba"
+)
+
+// Token type identifiers used in token exchange (rfc8693 section 3)
+const (
+	AccessTokenType  = "urn:ietf:params:oauth:token-type:access_token"
+	RefreshTokenType = "urn:ietf:params:oauth:token-type:refresh_token"
+)
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
@@ -48,3 +49,40 @@ func (c *context) abort(status int, msg string) {
 		panic(err)
 	}
 }
+
+// bearerToken returns the token sent in the Authorization header using the
+// Bearer scheme or an empty string if there is none
+func (c *context) bearerToken() string {
+	h := c.request.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[7:])
+}
+
+// parseToken verifies a token issued by the provider to any client. The
+// audience of the token is used to find the client whose keys verify it, or the
+// fallback client if the provider's tokenizer is not an Inspector. Nil claims
+// are returned if the token cannot be verified.
+func (c *context) parseToken(raw string, fallback *Client) (*TokenClaims, *Client, error) {
+	p := c.provider
+	client := fallback
+	if i, ok := p.Tokenizer.(Inspector); ok {
+		tc, err := i.Inspect(raw)
+		if err != nil {
+			return nil, nil, nil
+		}
+		client, err = p.Store.FetchClient(tc.clientID())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if client == nil {
+		return nil, nil, nil
+	}
+	tc, err := p.Tokenizer.Parse(raw, client.Keys.Verify)
+	if err != nil {
+		return nil, nil, nil
+	}
+	return tc, client, nil
+}
@@ -4,23 +4,80 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func (c *context) redirectAuthorization() {
+func (c *context) redirectAuthorization(r *authorizationRequest) {
 	next := c.provider.URL.Clone()
 	next.Path += "/dialog"
 	next.RawQuery = c.request.URL.RawQuery
+	// only the reference to a pushed request is passed on so that its
+	// parameters cannot be tampered with
+	if uri := c.request.Form.Get("request_uri"); uri != "" {
+		next.RawQuery = url.Values{"client_id": {c.request.Form.Get("client_id")}, "request_uri": {uri}}.Encode()
+	}
+	// the default scope of a request that omits one is passed on so that the
+	// dialog can present it
+	if c.request.Form.Get("request_uri") == "" && c.request.Form.Get("scope") == "" && len(r.scope) > 0 {
+		v, _ := url.ParseQuery(next.RawQuery)
+		v.Set("scope", r.scope.String())
+		next.RawQuery = v.Encode()
+	}
+	// the verified authorization details and resources are passed on so that
+	// the dialog can present them even when they were pushed or signed. They
+	// are ignored when the dialog sends a pushed or signed request back.
+	if len(r.details) > 0 || len(r.resources) > 0 {
+		v, _ := url.ParseQuery(next.RawQuery)
+		v.Del("authorization_details")
+		if len(r.details) > 0 {
+			v.Set("authorization_details", r.details.String())
+		}
+		v["resource"] = r.resources
+		next.RawQuery = v.Encode()
+	}
 	c.redirect(next.String())
 }
 
 type authorizationRequest struct {
-	client   *Client
-	session  *TokenClaims
-	redirect *StrictURL
-	scope    Scope
-	state    string
-	prompted bool
+	client          *Client
+	session         *TokenClaims
+	redirect        *StrictURL
+	redirectSent    bool
+	scope           Scope
+	state           string
+	prompted        bool
+	challenge       string
+	challengeMethod string
+	nonce           string
+	details         AuthorizationDetails
+	resources       []string
+	uses            []*oneTimeUse
+}
+
+// oneTimeUse identifies something that an authorization request was made with
+// and that may only be used for a single authorization response. It is
+// remembered until it expires and e is the error returned when it is reused.
+type oneTimeUse struct {
+	id      string
+	expires time.Time
+	e       *Error
+}
+
+// consume records the one-time uses of an authorization request once a
+// response is about to be issued. The error of the first one that was already
+// used is returned.
+func (c *context) consume(r *authorizationRequest) (*Error, error) {
+	for _, u := range r.uses {
+		used, err := replayed(c.provider.Store, u.id, u.expires)
+		if err != nil {
+			return nil, err
+		}
+		if used {
+			return u.e, nil
+		}
+	}
+	return nil, nil
 }
 
 var authorizeHandlers = map[string]func(*context, *authorizationRequest) error{
@@ -36,38 +93,66 @@ func authorizeWithCode(ctx *context, r *authorizationRequest) error {
 	v := url.Values{}
 	v.Set("state", r.state)
 
-	if c.GrantType != AuthorizationCode {
+	if !c.AllowsResponseType("code") {
 		ctx.fail(r.redirect, ErrWrongGrant, r.state)
 		return nil
 	}
+	if r.challenge == "" && (c.RequirePKCE || c.IsPublic()) {
+		ctx.fail(r.redirect, ErrChallengeRequired, r.state)
+		return nil
+	}
+	if r.challenge != "" && !validChallenge(r.challenge, r.challengeMethod) {
+		ctx.fail(r.redirect, ErrInvalidChallenge, r.state)
+		return nil
+	}
 
 	tc := NewTokenClaims(RoleCode, ctx.timestamp, ctx.timestamp.Add(p.Issuer.ExpiryForCode()))
 	tc.ID = randID()
 	tc.Audience = cid
 	tc.Subject = r.session.Subject
-	tc.Issuer = p.URL.String()
+	tc.Issuer = p.issuer()
 	tc.Scope = r.scope
 	tc.Grant = "authorization_code"
+	tc.Challenge = r.challenge
+	tc.ChallengeMethod = r.challengeMethod
+	tc.RedirectURI = r.redirect.String()
+	tc.RedirectURISent = r.redirectSent
+	tc.AuthorizationDetails = r.details
+	tc.Resources = r.resources
+	if r.scope[OpenID] {
+		tc.Nonce = r.nonce
+		tc.AuthTime = r.session.Issued
+	}
 
 	a, err := p.Store.FetchAuthorization(cid, uid)
 	if err != nil {
 		return err
 	}
 
-	authorized := a != nil && a.Scope.Equals(r.scope)
+	authorized := a != nil && p.ScopeHierarchy.Equals(a.Scope, r.scope) && a.Details.Equals(r.details)
 
 	if !authorized && !r.prompted {
-		ctx.redirectAuthorization()
+		ctx.redirectAuthorization(r)
 		return nil
 	}
 
 	if r.prompted {
-		err := p.Store.StoreAuthorization(NewAuthorization(cid, uid, r.scope))
-		if err != nil {
+		a := NewAuthorization(cid, uid, r.scope)
+		a.Details = r.details
+		if err := p.Store.StoreAuthorization(a); err != nil {
 			return err
 		}
 	}
 
+	e, err := ctx.consume(r)
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		ctx.fail(r.redirect, e, r.state)
+		return nil
+	}
+
 	code, err := p.Tokenizer.Tokenize(tc, r.client.Keys.Sign)
 	if err != nil {
 		return err
@@ -84,36 +169,50 @@ func authorizeWithToken(ctx *context, r *authorizationRequest) error {
 	v := url.Values{}
 	v.Set("state", r.state)
 
-	if c.GrantType != Implicit {
+	if !c.AllowsResponseType("token") {
 		ctx.fail(r.redirect, ErrWrongGrant, r.state)
 		return nil
 	}
 
+	tc := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, Implicit)))
+	tc.ID = randID()
+	tc.Subject = r.session.Subject
+	tc.Issuer = p.issuer()
+	tc.Scope = r.scope
+	tc.Grant = "implicit"
+	tc.AuthorizationDetails = r.details
+	if e := p.restrictToResource(tc, c, r.resources, nil); e != nil {
+		ctx.fail(r.redirect, e, r.state)
+		return nil
+	}
+
 	cid := r.client.ID
 	uid := r.session.Subject
 	a, err := p.Store.FetchAuthorization(cid, uid)
 	if err != nil {
 		return err
 	}
-	authorized := a != nil && a.Scope.Equals(r.scope)
+	authorized := a != nil && p.ScopeHierarchy.Equals(a.Scope, r.scope) && a.Details.Equals(r.details)
 	if !authorized && !r.prompted {
-		ctx.redirectAuthorization()
+		ctx.redirectAuthorization(r)
 		return nil
 	}
 	if r.prompted {
-		err := p.Store.StoreAuthorization(NewAuthorization(cid, uid, r.scope))
-		if err != nil {
+		a := NewAuthorization(cid, uid, r.scope)
+		a.Details = r.details
+		if err := p.Store.StoreAuthorization(a); err != nil {
 			return err
 		}
 	}
 
-	tc := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.Issuer.ExpiryForToken(c.GrantType)))
-	tc.ID = randID()
-	tc.Audience = cid
-	tc.Subject = r.session.Subject
-	tc.Issuer = p.URL.String()
-	tc.Scope = r.scope
-	tc.Grant = "implicit"
+	e, err := ctx.consume(r)
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		ctx.fail(r.redirect, e, r.state)
+		return nil
+	}
 
 	at, err := p.Tokenizer.Tokenize(tc, r.client.Keys.Sign)
 	if err != nil {
@@ -137,38 +236,100 @@ func handleAuthorize(ctx *context) error {
 	if ctx.request.Method == "POST" {
 		q = ctx.request.PostForm
 	}
+
+	// the parameters of a pushed request replace any others sent with the
+	// request_uri, which may only be used for a single authorization response
+	// (rfc9126 section 4)
+	var uses []*oneTimeUse
+	pushed := strings.HasPrefix(q.Get("request_uri"), RequestURIPrefix)
+	if pushed {
+		ps := p.pushedRequestStore()
+		if ps == nil {
+			ctx.abort(http.StatusBadRequest, "Bad request uri")
+			return nil
+		}
+		pr, err := ps.FetchPushedRequest(q.Get("request_uri"))
+		if err != nil {
+			return err
+		}
+		if pr == nil || pr.CID != q.Get("client_id") || !pr.Expires.After(ctx.timestamp) {
+			ctx.abort(http.StatusBadRequest, "Bad request uri")
+			return nil
+		}
+		q = pr.Params
+		uses = append(uses, &oneTimeUse{"pushed:" + pr.RequestURI, pr.Expires, ErrBadPushedRequest})
+	}
+
+	// only the parameters of a verified request object are used once one is
+	// sent by value or by reference (rfc9101 section 5)
+	signed := q.Get("request") != "" || q.Get("request_uri") != "" && !pushed
+	if signed {
+		params, use, err := ctx.requestObject(q)
+		if err != nil {
+			return err
+		}
+		if params == nil {
+			ctx.abort(http.StatusBadRequest, "Bad request object")
+			return nil
+		}
+		q = params
+		if use != nil {
+			uses = append(uses, use)
+		}
+	}
 	state := q.Get("state")
-	scope := ParseScope(q.Get("scope"))
 	prompted := ctx.request.Method == "POST"
 	v := url.Values{}
 	v.Set("state", state)
 
-	ru, err := ParseURL(q.Get("redirect_uri"))
+	// errors are only redirected once the redirect uri is known to belong to
+	// the client
+	client, err := p.Store.FetchClient(q.Get("client_id"))
 	if err != nil {
+		return err
+	}
+	if client == nil || client.Status != ClientActive {
+		ctx.abort(http.StatusBadRequest, "Client not found")
+		return nil
+	}
+	ru := client.MatchRedirectURI(q.Get("redirect_uri"))
+	if ru == nil {
 		ctx.abort(http.StatusBadRequest, "Bad redirect uri")
 		return nil
 	}
+	if client.RequirePushedRequests && !pushed {
+		ctx.fail(ru, ErrPushedRequestRequired, state)
+		return nil
+	}
+	if client.RequireSignedRequests && !signed {
+		ctx.fail(ru, ErrSignedRequestRequired, state)
+		return nil
+	}
 
 	handler, found := authorizeHandlers[q.Get("response_type")]
 	if !found {
 		ctx.redirect(ru.StringWithParams(mergeValues(ErrUnsupportResponseType.Values(), v)))
 		return nil
 	}
-
-	client, err := p.Store.FetchClient(q.Get("client_id"))
-	if err != nil {
-		return err
+	scope := p.requestedScope(client, q.Get("scope"))
+	if !p.ScopeHierarchy.Contains(client.Scope, scope) {
+		ctx.fail(ru, ErrScopeNotAllowed, state)
+		return nil
 	}
-	if client == nil || client.Status != ClientActive {
-		ctx.redirect(ru.StringWithParams(mergeValues(ErrClientNotFound.Values(), v)))
+	// actions that may not be issued are refused before the resource owner is
+	// asked for consent
+	if !p.scopePermitted(client, scope, responseGrant(q.Get("response_type"))) {
+		ctx.fail(ru, ErrScopeNotAllowed, state)
 		return nil
 	}
-	if client.RedirectURI.String() != ru.String() {
-		ctx.redirect(ru.StringWithParams(mergeValues(ErrBadRedirect.Values(), v)))
+	details, ok := p.authorizationDetails(client, q.Get("authorization_details"))
+	if !ok {
+		ctx.fail(ru, ErrBadAuthzDetails, state)
 		return nil
 	}
-	if !client.Scope.Contains(scope) {
-		ctx.fail(ru, ErrScopeNotAllowed, state)
+	resources, ok := p.requestedResources(q)
+	if !ok {
+		ctx.fail(ru, ErrBadResource, state)
 		return nil
 	}
 
@@ -177,7 +338,13 @@ func handleAuthorize(ctx *context) error {
 		panic(err) // TODO redirect and then spew
 	}
 
-	req := &authorizationRequest{client, sc, ru, scope, state, prompted}
+	challenge := q.Get("code_challenge")
+	method := q.Get("code_challenge_method")
+	if challenge != "" && method == "" {
+		method = PKCEPlain
+	}
+
+	req := &authorizationRequest{client, sc, ru, q.Get("redirect_uri") != "", scope, state, prompted, challenge, method, q.Get("nonce"), details, resources, uses}
 
 	return handler(ctx, req)
 }
@@ -12,7 +12,7 @@ func BenchmarkAuthorize_code(b *testing.B) {
 	client := NewClient("Test Client", AuthorizationCode)
 	client.Scope = ParseScope("openid,email")
 	client.Status = ClientActive
-	client.RedirectURI = MustParseURL("http://example.com")
+	client.RedirectURIs = []*StrictURL{MustParseURL("http://example.com")}
 	err := testProvider.Store.CreateClient(client)
 	if err != nil {
 		panic(err)
@@ -53,7 +53,7 @@ func BenchmarkAuthorize_implicit(b *testing.B) {
 	client := NewClient("Test Client", Implicit)
 	client.Scope = ParseScope("openid,email")
 	client.Status = ClientActive
-	client.RedirectURI = MustParseURL("http://example.com")
+	client.RedirectURIs = []*StrictURL{MustParseURL("http://example.com")}
 	err := testProvider.Store.CreateClient(client)
 	if err != nil {
 		panic(err)
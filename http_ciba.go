@@ -0,0 +1,362 @@
+package ohauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// client notifications must not hold up the resource owner's approval
+const notificationTimeout = 10 * time.Second
+
+// backchannelAuthenticationResponse is defined in CIBA core section 7.3
+type backchannelAuthenticationResponse struct {
+	AuthReqID string `json:"auth_req_id"`
+	ExpiresIn int64  `json:"expires_in"`
+	Interval  int64  `json:"interval,omitempty"`
+}
+
+// backchannelNotification is the body of a ping or push notification (CIBA
+// core section 10). Pushed notifications carry either the tokens or an error.
+type backchannelNotification struct {
+	AuthReqID string `json:"auth_req_id"`
+	*tokenResponse
+	*Error
+}
+
+// a backchannel authentication request names the resource owner with exactly
+// one of these hints
+var loginHints = []string{"login_hint", "login_hint_token", "id_token_hint"}
+
+// identifyUser finds the resource owner named by a login hint. An ID token
+// hint must be one the provider issued to the client, other hints are resolved
+// by the application.
+func (c *context) identifyUser(client *Client, kind, hint string) (string, error) {
+	p := c.provider
+	if kind != "id_token_hint" {
+		return p.Approver.IdentifyUser(client, kind, hint)
+	}
+	tc, err := p.Tokenizer.Parse(hint, p.Keys.Verify)
+	if err != nil || tc.Role != RoleIdentity || !p.issuedByProvider(tc.Issuer) || tc.Audience != client.ID {
+		return "", nil
+	}
+	return tc.Subject, nil
+}
+
+// handleBackchannelAuthentication starts a backchannel authentication request
+// (CIBA core section 7). The resource owner is asked for approval through the
+// provider's BackchannelApprover while the client waits for the outcome using
+// its token delivery mode.
+func handleBackchannelAuthentication(ctx *context) error {
+	p := ctx.provider
+	bs := p.backchannelStore()
+	if bs == nil {
+		ctx.abort(http.StatusNotFound, "Not found")
+		return nil
+	}
+	if ctx.request.Method != "POST" {
+		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+	if err := ctx.request.ParseForm(); err != nil {
+		return err
+	}
+
+	c, err := ctx.authenticateClient()
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		ctx.failClientAuth()
+		return nil
+	}
+	// only confidential clients may start requests on a resource owner's behalf
+	if !c.AllowsGrant(CIBA) || c.IsPublic() {
+		ctx.json(http.StatusBadRequest, ErrWrongGrant)
+		return nil
+	}
+
+	f := ctx.request.PostForm
+	scope := p.requestedScope(c, f.Get("scope"))
+	if !scope[OpenID] || !p.ScopeHierarchy.Contains(c.Scope, scope) || !p.scopePermitted(c, scope, CIBA) {
+		ctx.json(http.StatusBadRequest, ErrScopeNotAllowed)
+		return nil
+	}
+	mode := c.DeliveryMode()
+	if mode != DeliveryPoll && f.Get("client_notification_token") == "" {
+		ctx.json(http.StatusBadRequest, ErrNotificationToken)
+		return nil
+	}
+
+	kind := ""
+	for _, k := range loginHints {
+		if f.Get(k) == "" {
+			continue
+		}
+		if kind != "" {
+			kind = ""
+			break
+		}
+		kind = k
+	}
+	if kind == "" {
+		ctx.json(http.StatusBadRequest, ErrBadLoginHint)
+		return nil
+	}
+	uid, err := ctx.identifyUser(c, kind, f.Get(kind))
+	if err != nil {
+		return err
+	}
+	if uid == "" {
+		ctx.json(http.StatusBadRequest, ErrUnknownUser)
+		return nil
+	}
+
+	// the client may ask for the request to expire sooner than usual
+	exp := p.Issuer.ExpiryForCode()
+	if raw := f.Get("requested_expiry"); raw != "" {
+		secs, err := strconv.Atoi(raw)
+		if err != nil || secs <= 0 {
+			ctx.json(http.StatusBadRequest, ErrBadRequestedExpiry)
+			return nil
+		}
+		if d := time.Duration(secs) * time.Second; d < exp {
+			exp = d
+		}
+	}
+
+	b := NewBackchannelAuthentication(c.ID, uid, scope, ctx.timestamp, ctx.timestamp.Add(exp))
+	b.BindingMessage = f.Get("binding_message")
+	b.NotificationToken = f.Get("client_notification_token")
+	if err := bs.StoreBackchannelAuthentication(b); err != nil {
+		return err
+	}
+	if err := p.Approver.RequestApproval(c, b); err != nil {
+		return err
+	}
+
+	res := &backchannelAuthenticationResponse{
+		AuthReqID: b.AuthReqID,
+		ExpiresIn: int64(b.Expires.Sub(ctx.timestamp) / time.Second),
+	}
+	if mode != DeliveryPush {
+		res.Interval = int64(b.Interval / time.Second)
+	}
+	ctx.json(http.StatusOK, res)
+	return nil
+}
+
+// backchannelTokens issues the tokens for an approved backchannel
+// authentication request. Tokens collected from the token endpoint may be
+// bound to a proof of possession while pushed tokens are bearer tokens whose ID
+// token identifies the request they were issued for.
+func backchannelTokens(ctx *context, c *Client, b *BackchannelAuthentication, gr *grantRequest) (*tokenResponse, *Error, error) {
+	p := ctx.provider
+	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, CIBA)))
+	at.ID = randID()
+	at.GrantID = randID()
+	at.Subject = b.UID
+	at.Issuer = p.issuer()
+	at.Scope = b.Scope
+	at.Grant = CIBA
+
+	var requested []string
+	if gr != nil {
+		requested = gr.form["resource"]
+	}
+	if e := p.restrictToResource(at, c, nil, requested); e != nil {
+		return nil, e, nil
+	}
+	tokenType := "bearer"
+	if gr != nil {
+		tokenType = gr.bind(at)
+	}
+
+	sat, err := p.Tokenizer.Tokenize(at, c.Keys.Sign)
+	if err != nil {
+		return nil, nil, err
+	}
+	srt, err := issueRefreshToken(ctx, c, at, b.Scope, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	idt := newIDToken(ctx, c, &TokenClaims{Subject: b.UID, Grant: CIBA, AuthTime: b.Approved.Unix()}, sat, "")
+	if gr == nil {
+		idt.AuthReqID = b.AuthReqID
+		if srt != "" {
+			idt.RefreshTokenHash = tokenHash(srt)
+		}
+	}
+	sidt, err := p.signIDToken(idt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &tokenResponse{
+		sat,
+		tokenType,
+		at.Expires - time.Now().Unix(),
+		srt,
+		sidt,
+		at.AuthorizationDetails,
+	}, nil, nil
+}
+
+func grantWithBackchannel(ctx *context, gr *grantRequest) error {
+	p := ctx.provider
+	c := gr.client
+	bs := p.backchannelStore()
+
+	// clients using the push mode never collect their tokens
+	if c.DeliveryMode() == DeliveryPush {
+		ctx.json(http.StatusBadRequest, ErrUnauthorized)
+		return nil
+	}
+
+	b, err := bs.FetchBackchannelAuthentication(gr.form.Get("auth_req_id"))
+	if err != nil {
+		return err
+	}
+	if b == nil || b.CID != c.ID || b.Status == BackchannelRedeemed {
+		ctx.json(http.StatusBadRequest, ErrBadAuthReqID)
+		return nil
+	}
+	if !b.Expires.After(ctx.timestamp) {
+		ctx.json(http.StatusBadRequest, ErrAuthReqExpired)
+		return nil
+	}
+
+	switch b.Status {
+	case BackchannelDenied:
+		ctx.json(http.StatusBadRequest, ErrAccessDenied)
+		return nil
+	case BackchannelPending:
+		e := ErrDevicePending
+		if ctx.timestamp.Sub(b.LastPolled) < b.Interval {
+			b.Interval += deviceSlowDown
+			e = ErrDeviceSlowDown
+		}
+		b.LastPolled = ctx.timestamp
+		if err := bs.StoreBackchannelAuthentication(b); err != nil {
+			return err
+		}
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
+
+	if !p.ScopeHierarchy.Contains(c.Scope, b.Scope) || !p.scopePermitted(c, b.Scope, CIBA) {
+		ctx.json(http.StatusForbidden, ErrScopeNotAllowed)
+		return nil
+	}
+
+	res, e, err := backchannelTokens(ctx, c, b, gr)
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
+
+	b.Status = BackchannelRedeemed
+	if err := bs.StoreBackchannelAuthentication(b); err != nil {
+		return err
+	}
+
+	ctx.json(http.StatusOK, res)
+	return nil
+}
+
+// CompleteBackchannelAuthentication records a resource owner's decision on a
+// backchannel authentication request. Approvals are stored like those given at
+// the authorization endpoint. A client using the ping mode is then told to
+// collect the outcome from the token endpoint while one using the push mode is
+// sent the tokens or the denial.
+func (p *Provider) CompleteBackchannelAuthentication(authReqID string, approved bool) error {
+	ctx := &context{p, nil, nil, time.Now()}
+	bs := p.backchannelStore()
+	if bs == nil {
+		return ErrBadAuthReqID
+	}
+	b, err := bs.FetchBackchannelAuthentication(authReqID)
+	if err != nil {
+		return err
+	}
+	if b == nil || b.Status != BackchannelPending || !b.Expires.After(ctx.timestamp) {
+		return ErrBadAuthReqID
+	}
+	c, err := p.Store.FetchClient(b.CID)
+	if err != nil {
+		return err
+	}
+	if c == nil || c.Status != ClientActive {
+		return ErrClientNotFound
+	}
+
+	b.Status = BackchannelDenied
+	if approved {
+		b.Status = BackchannelApproved
+		b.Approved = ctx.timestamp
+		if err := p.Store.StoreAuthorization(NewAuthorization(c.ID, b.UID, b.Scope)); err != nil {
+			return err
+		}
+	}
+
+	n := &backchannelNotification{AuthReqID: b.AuthReqID}
+	switch c.DeliveryMode() {
+	case DeliveryPoll:
+		return bs.StoreBackchannelAuthentication(b)
+	case DeliveryPush:
+		if !approved {
+			n.Error = ErrAccessDenied
+			break
+		}
+		res, e, err := backchannelTokens(ctx, c, b, nil)
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			return e
+		}
+		n.tokenResponse = res
+		b.Status = BackchannelRedeemed
+	}
+	if err := bs.StoreBackchannelAuthentication(b); err != nil {
+		return err
+	}
+	return p.notifyClient(c, b, n)
+}
+
+// notifyClient posts a notification to a client's notification endpoint
+// using the bearer token the client sent with its request (CIBA core section
+// 10.2)
+func (p *Provider) notifyClient(c *Client, b *BackchannelAuthentication, n *backchannelNotification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.BackchannelNotificationEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+b.NotificationToken)
+
+	hc := p.HTTPClient
+	if hc == nil {
+		hc = &http.Client{Timeout: notificationTimeout}
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("client notification endpoint responded with %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package ohauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackchannelAuthentication(t *testing.T) {
+	approver := NewTestingApprover("alice")
+	p := *testProvider
+	p.Approver = approver
+
+	notifications := make(chan map[string]interface{}, 1)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Error(err)
+		}
+		n["authorization"] = r.Header.Get("Authorization")
+		notifications <- n
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	p.HTTPClient = srv.Client()
+
+	newClient := func(mode string) *Client {
+		c := NewClient("Call Center", CIBA)
+		c.Scope = ParseScope("openid,profile")
+		c.Status = ClientActive
+		c.BackchannelDeliveryMode = mode
+		c.BackchannelNotificationEndpoint = srv.URL + "/cb"
+		if err := p.Store.CreateClient(c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	do := func(h func(*context) error, c *Client, form url.Values, ts time.Time) (int, map[string]interface{}) {
+		form.Set("client_id", c.ID)
+		form.Set("client_secret", c.Secret)
+		r := httptest.NewRequest("POST", "https://authz.example.com/bc-authorize", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := h(&context{&p, w, r, ts}); err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]interface{}{}
+		if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, out
+	}
+	start := func(c *Client) string {
+		status, out := do(handleBackchannelAuthentication, c, url.Values{
+			"scope":                     {"openid,profile"},
+			"login_hint":                {"alice"},
+			"binding_message":           {"W4SCT"},
+			"client_notification_token": {"8d67dc78-7faa-4d41-aabd-67707b374255"},
+		}, time.Now())
+		if status != http.StatusOK {
+			t.Fatalf("EXPECTED = %d - GOT = %d %v", http.StatusOK, status, out)
+		}
+		pending := approver.Pending()
+		if len(pending) != 1 || pending[0].UID != "alice" || pending[0].BindingMessage != "W4SCT" {
+			t.Fatalf("approval was not requested: %+v", pending)
+		}
+		return out["auth_req_id"].(string)
+	}
+	poll := func(c *Client, id string, ts time.Time) (int, map[string]interface{}) {
+		return do(handleGrant, c, url.Values{"grant_type": {CIBA}, "auth_req_id": {id}}, ts)
+	}
+
+	poller := newClient(DeliveryPoll)
+	table := []struct {
+		name string
+		form url.Values
+		code string
+	}{
+		{"unknown user", url.Values{"scope": {"openid"}, "login_hint": {"bob"}}, UnknownUserID},
+		{"two hints", url.Values{"scope": {"openid"}, "login_hint": {"alice"}, "login_hint_token": {"token"}}, InvalidRequest},
+		{"no hint", url.Values{"scope": {"openid"}}, InvalidRequest},
+		{"not openid", url.Values{"scope": {"profile"}, "login_hint": {"alice"}}, InvalidScope},
+		{"bad expiry", url.Values{"scope": {"openid"}, "login_hint": {"alice"}, "requested_expiry": {"-1"}}, InvalidRequest},
+	}
+	for _, r := range table {
+		if status, out := do(handleBackchannelAuthentication, poller, r.form, time.Now()); status != http.StatusBadRequest || out["error"] != r.code {
+			t.Fatalf("%s: EXPECTED = %s - GOT = %d %v", r.name, r.code, status, out)
+		}
+	}
+
+	now := time.Now()
+	id := start(poller)
+	if _, out := poll(poller, id, now); out["error"] != AuthorizationPending {
+		t.Fatalf("EXPECTED = %s - GOT = %v", AuthorizationPending, out)
+	}
+	if _, out := poll(poller, id, now.Add(time.Second)); out["error"] != SlowDown {
+		t.Fatalf("EXPECTED = %s - GOT = %v", SlowDown, out)
+	}
+	if err := p.CompleteBackchannelAuthentication(id, true); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := p.Store.FetchAuthorization(poller.ID, "alice"); err != nil || a == nil {
+		t.Fatalf("approval was not recorded: %v %v", a, err)
+	}
+	status, out := poll(poller, id, now.Add(time.Minute))
+	if status != http.StatusOK || out["id_token"] == nil {
+		t.Fatalf("EXPECTED tokens - GOT = %d %v", status, out)
+	}
+	if _, out := poll(poller, id, now.Add(2*time.Minute)); out["error"] != InvalidGrant {
+		t.Fatalf("redeemed request: EXPECTED = %s - GOT = %v", InvalidGrant, out)
+	}
+
+	id = start(poller)
+	if err := p.CompleteBackchannelAuthentication(id, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, out := poll(poller, id, time.Now()); out["error"] != AccessDenied {
+		t.Fatalf("denied request: EXPECTED = %s - GOT = %v", AccessDenied, out)
+	}
+
+	pinged := newClient(DeliveryPing)
+	id = start(pinged)
+	if err := p.CompleteBackchannelAuthentication(id, true); err != nil {
+		t.Fatal(err)
+	}
+	n := <-notifications
+	if n["auth_req_id"] != id || n["authorization"] != "Bearer 8d67dc78-7faa-4d41-aabd-67707b374255" || n["access_token"] != nil {
+		t.Fatalf("unexpected ping notification: %v", n)
+	}
+	if status, out := poll(pinged, id, time.Now()); status != http.StatusOK {
+		t.Fatalf("ping client: EXPECTED = %d - GOT = %d %v", http.StatusOK, status, out)
+	}
+
+	pushed := newClient(DeliveryPush)
+	id = start(pushed)
+	if err := p.CompleteBackchannelAuthentication(id, true); err != nil {
+		t.Fatal(err)
+	}
+	n = <-notifications
+	if n["auth_req_id"] != id || n["access_token"] == nil {
+		t.Fatalf("tokens were not pushed: %v", n)
+	}
+	idt, err := p.Tokenizer.Parse(n["id_token"].(string), p.Keys.Verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idt.AuthReqID != id || idt.Subject != "alice" || idt.RefreshTokenHash != "" {
+		t.Fatalf("unexpected pushed ID token: %+v", idt)
+	}
+	if _, out := poll(pushed, id, time.Now()); out["error"] != UnauthorizedClient {
+		t.Fatalf("push client polling: EXPECTED = %s - GOT = %v", UnauthorizedClient, out)
+	}
+}
@@ -0,0 +1,259 @@
+package ohauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// deviceAuthorizationResponse is defined in rfc8628 section 3.2
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+func handleDeviceAuthorization(ctx *context) error {
+	p := ctx.provider
+	ds := p.deviceStore()
+	if ds == nil {
+		ctx.abort(http.StatusNotFound, "Not found")
+		return nil
+	}
+	if ctx.request.Method != "POST" {
+		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+	if err := ctx.request.ParseForm(); err != nil {
+		return err
+	}
+
+	c, err := ctx.authenticateClient()
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		ctx.failClientAuth()
+		return nil
+	}
+	if !c.AllowsGrant(DeviceCode) {
+		ctx.json(http.StatusBadRequest, ErrWrongGrant)
+		return nil
+	}
+
+	scope := p.requestedScope(c, ctx.request.PostForm.Get("scope"))
+	if !p.ScopeHierarchy.Contains(c.Scope, scope) || !p.scopePermitted(c, scope, DeviceCode) {
+		ctx.json(http.StatusBadRequest, ErrScopeNotAllowed)
+		return nil
+	}
+
+	d := NewDeviceAuthorization(c.ID, scope, ctx.timestamp, ctx.timestamp.Add(p.Issuer.ExpiryForCode()))
+	if err := ds.StoreDeviceAuthorization(d); err != nil {
+		return err
+	}
+
+	verify := p.endpoint("/device")
+	ctx.json(http.StatusOK, &deviceAuthorizationResponse{
+		d.DeviceCode,
+		d.UserCode,
+		verify,
+		verify + "?" + url.Values{"user_code": {d.UserCode}}.Encode(),
+		int64(d.Expires.Sub(ctx.timestamp) / time.Second),
+		int64(d.Interval / time.Second),
+	})
+	return nil
+}
+
+// redirectDevice sends the resource owner to the dialog to approve a device or
+// to be told the outcome of their decision
+func (c *context) redirectDevice(d *DeviceAuthorization, e *Error) {
+	v := url.Values{}
+	v.Set("user_code", d.UserCode)
+	v.Set("client_id", d.CID)
+	v.Set("scope", d.Scope.String())
+	v.Set("device_status", d.Status)
+	if e == nil && d.ConfirmToken != "" {
+		v.Set("confirm_token", d.ConfirmToken)
+	}
+	next := c.provider.URL.Clone()
+	next.Path += "/dialog"
+	if e != nil {
+		v = mergeValues(v, e.Values())
+	}
+	c.redirect(next.StringWithParams(v))
+}
+
+// handleDevice is the verification uri where a resource owner enters the user
+// code shown on their device. The resource owner is always prompted through the
+// dialog, which shows the user code, and must post their decision back even if
+// the client was authorized before. Otherwise a link to the verification uri
+// sent by an attacker would approve the attacker's device (rfc8628 section
+// 5.4). The decision is only accepted with the confirm token that was handed
+// to the same resource owner along with the dialog, so that a form posted from
+// another site cannot approve a device on their behalf.
+func handleDevice(ctx *context) error {
+	p := ctx.provider
+	ds := p.deviceStore()
+	if ds == nil {
+		ctx.abort(http.StatusNotFound, "Not found")
+		return nil
+	}
+	if err := ctx.request.ParseForm(); err != nil {
+		ctx.abort(http.StatusBadRequest, "Bad request")
+		return nil
+	}
+	q := ctx.request.Form
+	if ctx.request.Method == "POST" {
+		q = ctx.request.PostForm
+	}
+	prompted := ctx.request.Method == "POST"
+
+	d, err := ds.FetchDeviceAuthorizationByUserCode(NormalizeUserCode(q.Get("user_code")))
+	if err != nil {
+		return err
+	}
+	if d == nil || d.Status != DevicePending || !d.Expires.After(ctx.timestamp) {
+		ctx.json(http.StatusBadRequest, ErrUserCodeInvalid)
+		return nil
+	}
+	c, err := p.Store.FetchClient(d.CID)
+	if err != nil {
+		return err
+	}
+	if c == nil || c.Status != ClientActive {
+		ctx.json(http.StatusBadRequest, ErrClientNotFound)
+		return nil
+	}
+
+	sc, err := p.Authenticator.AuthenticateRequest(ctx.request, c)
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		ctx.redirectDevice(d, ErrAccessDenied)
+		return nil
+	}
+
+	if !prompted {
+		d.UID = sc.Subject
+		d.ConfirmToken = randToken()
+		if err := ds.StoreDeviceAuthorization(d); err != nil {
+			return err
+		}
+		ctx.redirectDevice(d, nil)
+		return nil
+	}
+
+	confirmed := d.ConfirmToken != "" && d.UID == sc.Subject &&
+		subtle.ConstantTimeCompare([]byte(q.Get("confirm_token")), []byte(d.ConfirmToken)) == 1
+	if !confirmed {
+		ctx.redirectDevice(d, ErrAccessDenied)
+		return nil
+	}
+
+	d.ConfirmToken = ""
+	d.Status = DeviceApproved
+	if q.Get("action") == "deny" {
+		d.Status = DeviceDenied
+	}
+	if d.Status == DeviceApproved {
+		if err := p.Store.StoreAuthorization(NewAuthorization(c.ID, sc.Subject, d.Scope)); err != nil {
+			return err
+		}
+	}
+	if err := ds.StoreDeviceAuthorization(d); err != nil {
+		return err
+	}
+
+	ctx.redirectDevice(d, nil)
+	return nil
+}
+
+func grantWithDeviceCode(ctx *context, gr *grantRequest) error {
+	p := ctx.provider
+	c := gr.client
+	ds := p.deviceStore()
+
+	d, err := ds.FetchDeviceAuthorization(gr.form.Get("device_code"))
+	if err != nil {
+		return err
+	}
+	if d == nil || d.CID != c.ID || d.Status == DeviceRedeemed {
+		ctx.json(http.StatusBadRequest, ErrDeviceCodeInvalid)
+		return nil
+	}
+	if !d.Expires.After(ctx.timestamp) {
+		ctx.json(http.StatusBadRequest, ErrDeviceExpired)
+		return nil
+	}
+
+	switch d.Status {
+	case DeviceDenied:
+		ctx.json(http.StatusBadRequest, ErrAccessDenied)
+		return nil
+	case DevicePending:
+		e := ErrDevicePending
+		if ctx.timestamp.Sub(d.LastPolled) < d.Interval {
+			d.Interval += deviceSlowDown
+			e = ErrDeviceSlowDown
+		}
+		d.LastPolled = ctx.timestamp
+		if err := ds.StoreDeviceAuthorization(d); err != nil {
+			return err
+		}
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
+
+	if !p.ScopeHierarchy.Contains(c.Scope, d.Scope) || !p.scopePermitted(c, d.Scope, DeviceCode) {
+		ctx.json(http.StatusForbidden, ErrScopeNotAllowed)
+		return nil
+	}
+
+	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, DeviceCode)))
+	at.ID = randID()
+	at.GrantID = randID()
+	at.Subject = d.UID
+	at.Issuer = p.issuer()
+	at.Scope = d.Scope
+	at.Grant = DeviceCode
+	if e := p.restrictToResource(at, c, nil, gr.form["resource"]); e != nil {
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
+
+	// the device code is used up before any token is issued so that another
+	// request redeeming it at the same time is refused
+	redeemed, err := ds.RedeemDeviceAuthorization(d.DeviceCode)
+	if err != nil {
+		return err
+	}
+	if !redeemed {
+		ctx.json(http.StatusBadRequest, ErrDeviceCodeInvalid)
+		return nil
+	}
+
+	tokenType := gr.bind(at)
+	sat, err := p.Tokenizer.Tokenize(at, c.Keys.Sign)
+	if err != nil {
+		return err
+	}
+	srt, err := issueRefreshToken(ctx, c, at, d.Scope, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx.json(http.StatusOK, &tokenResponse{
+		sat,
+		tokenType,
+		at.Expires - time.Now().Unix(),
+		srt,
+		"",
+		at.AuthorizationDetails,
+	})
+	return nil
+}
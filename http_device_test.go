@@ -0,0 +1,136 @@
+package ohauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// subjectAuthenticator treats every request as coming from a signed in user
+type subjectAuthenticator struct {
+	Authenticator
+	subject string
+}
+
+func (a *subjectAuthenticator) AuthenticateRequest(r *http.Request, client *Client) (*TokenClaims, error) {
+	return &TokenClaims{Subject: a.subject, Issued: time.Now().Unix()}, nil
+}
+
+func TestDeviceFlow(t *testing.T) {
+	p := *testProvider
+	p.Authenticator = &subjectAuthenticator{testProvider.Authenticator, "testuser"}
+
+	client := NewClient("TV App", DeviceCode)
+	client.Scope = ParseScope("profile")
+	client.Status = ClientActive
+	if err := p.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(h func(*context) error, method, path string, form url.Values, ts time.Time) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "https://authz.example.com"+path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := h(&context{&p, w, r, ts}); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	now := time.Now()
+	w := do(handleDeviceAuthorization, "POST", "/device_authorization", url.Values{
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"scope":         {"profile"},
+	}, now)
+	res := &deviceAuthorizationResponse{}
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil {
+		t.Fatal(err)
+	}
+
+	poll := func(ts time.Time) (int, string) {
+		w := do(handleGrant, "POST", "/token", url.Values{
+			"grant_type":    {DeviceCode},
+			"client_id":     {client.ID},
+			"client_secret": {client.Secret},
+			"device_code":   {res.DeviceCode},
+		}, ts)
+		out := map[string]interface{}{}
+		if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		e, _ := out["error"].(string)
+		return w.Code, e
+	}
+
+	if _, e := poll(now); e != AuthorizationPending {
+		t.Fatalf("EXPECTED = %s - GOT = %s", AuthorizationPending, e)
+	}
+	if _, e := poll(now.Add(time.Second)); e != SlowDown {
+		t.Fatalf("EXPECTED = %s - GOT = %s", SlowDown, e)
+	}
+
+	// an earlier authorization never approves a device without confirmation
+	if err := p.Store.StoreAuthorization(NewAuthorization(client.ID, "testuser", client.Scope)); err != nil {
+		t.Fatal(err)
+	}
+	w = do(handleDevice, "GET", "/device?user_code="+url.QueryEscape(res.UserCode), url.Values{}, now)
+	loc := w.Header().Get("Location")
+	if !strings.Contains(loc, "device_status="+DevicePending) || !strings.Contains(loc, "user_code="+res.UserCode) {
+		t.Fatalf("device was approved without confirmation: %d %s", w.Code, loc)
+	}
+	if _, e := poll(now.Add(30 * time.Second)); e != AuthorizationPending {
+		t.Fatalf("EXPECTED = %s - GOT = %s", AuthorizationPending, e)
+	}
+
+	dialog, err := url.Parse(loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := dialog.Query().Get("confirm_token")
+	if token == "" {
+		t.Fatalf("dialog was not given a confirm token: %s", loc)
+	}
+
+	// a decision posted without the confirm token or by another resource owner
+	// is refused
+	userCode := strings.ToLower(strings.Replace(res.UserCode, "-", " ", 1))
+	w = do(handleDevice, "POST", "/device", url.Values{"user_code": {userCode}}, now)
+	if loc := w.Header().Get("Location"); !strings.Contains(loc, "error="+AccessDenied) {
+		t.Fatalf("device was approved without a confirm token: %d %s", w.Code, loc)
+	}
+	p.Authenticator = &subjectAuthenticator{testProvider.Authenticator, "otheruser"}
+	w = do(handleDevice, "POST", "/device", url.Values{"user_code": {userCode}, "confirm_token": {token}}, now)
+	if loc := w.Header().Get("Location"); !strings.Contains(loc, "error="+AccessDenied) {
+		t.Fatalf("device was approved by another resource owner: %d %s", w.Code, loc)
+	}
+	p.Authenticator = &subjectAuthenticator{testProvider.Authenticator, "testuser"}
+	if _, e := poll(now.Add(45 * time.Second)); e != AuthorizationPending {
+		t.Fatalf("EXPECTED = %s - GOT = %s", AuthorizationPending, e)
+	}
+
+	w = do(handleDevice, "POST", "/device", url.Values{"user_code": {userCode}, "confirm_token": {token}}, now)
+	if w.Code != http.StatusFound || !strings.Contains(w.Header().Get("Location"), "device_status="+DeviceApproved) {
+		t.Fatalf("device was not approved: %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	if status, e := poll(now.Add(time.Minute)); status != http.StatusOK {
+		t.Fatalf("EXPECTED = %d - GOT = %d %s", http.StatusOK, status, e)
+	}
+	if _, e := poll(now.Add(2 * time.Minute)); e != InvalidGrant {
+		t.Fatalf("device code redeemed twice: %s", e)
+	}
+}
+
+func TestRandUserCode(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code := randUserCode()
+		if len(code) != 9 || code[4] != '-' || NormalizeUserCode(code) != code {
+			t.Fatalf("unexpected user code: %s", code)
+		}
+	}
+}
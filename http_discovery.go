@@ -0,0 +1,213 @@
+package ohauth
+
+import (
+	"net/http"
+	"sort"
+)
+
+// metadata describes the provider as specified in rfc8414 and OpenID Connect
+// Discovery 1.0. Fields are generated from the provider's configuration.
+type metadata struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	IntrospectionEndpoint         string   `json:"introspection_endpoint"`
+	RevocationEndpoint            string   `json:"revocation_endpoint"`
+	JWKSURI                       string   `json:"jwks_uri"`
+	DeviceAuthorizationEndpoint   string   `json:"device_authorization_endpoint,omitempty"`
+	PushedRequestEndpoint         string   `json:"pushed_authorization_request_endpoint,omitempty"`
+	RegistrationEndpoint          string   `json:"registration_endpoint,omitempty"`
+	ScopesSupported               []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported        []string `json:"response_types_supported"`
+	ResponseModesSupported        []string `json:"response_modes_supported"`
+	GrantTypesSupported           []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgs  []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	IntrospectionAuthMethods      []string `json:"introspection_endpoint_auth_methods_supported"`
+	RevocationAuthMethods         []string `json:"revocation_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+	SubjectTypesSupported         []string `json:"subject_types_supported"`
+	IDTokenSigningAlgs            []string `json:"id_token_signing_alg_values_supported"`
+	DPoPSigningAlgs               []string `json:"dpop_signing_alg_values_supported"`
+	TLSCertificateBoundTokens     bool     `json:"tls_client_certificate_bound_access_tokens"`
+	RequestParameterSupported     bool     `json:"request_parameter_supported"`
+	RequestURIParameterSupported  bool     `json:"request_uri_parameter_supported"`
+	RequireRequestURIRegistration bool     `json:"require_request_uri_registration"`
+	RequestObjectSigningAlgs      []string `json:"request_object_signing_alg_values_supported"`
+	RequestObjectEncryptionAlgs   []string `json:"request_object_encryption_alg_values_supported,omitempty"`
+	RequestObjectEncryptionEncs   []string `json:"request_object_encryption_enc_values_supported,omitempty"`
+	AuthorizationDetailTypes      []string `json:"authorization_details_types_supported,omitempty"`
+	BackchannelEndpoint           string   `json:"backchannel_authentication_endpoint,omitempty"`
+	BackchannelDeliveryModes      []string `json:"backchannel_token_delivery_modes_supported,omitempty"`
+}
+
+// endpoint returns the absolute url of one of the provider's endpoints
+func (p *Provider) endpoint(path string) string {
+	u := p.URL.Clone()
+	u.Path += path
+	u.Fragment = ""
+	return u.String()
+}
+
+// issuer returns the provider's issuer identifier which is its url without
+// the fragment that StrictURL adds (rfc8414 section 2)
+func (p *Provider) issuer() string {
+	return p.endpoint("")
+}
+
+// issuedByProvider determines if an iss claim identifies the provider. Tokens
+// issued before the issuer identifier lost its fragment are still accepted.
+func (p *Provider) issuedByProvider(iss string) bool {
+	return iss == p.issuer() || iss == p.URL.String()
+}
+
+// signingAlg returns the JWS algorithm used by a tokenizer if it is known
+func signingAlg(t Tokenizer) string {
+	if jt, ok := t.(*jwtTokenizer); ok && jt.method != nil {
+		return jt.method.Alg()
+	}
+	return ""
+}
+
+func (p *Provider) metadata() *metadata {
+	responseTypes := []string{}
+	for rt := range authorizeHandlers {
+		responseTypes = append(responseTypes, rt)
+	}
+	grantTypes := []string{}
+	for gt := range grantHandlers {
+		// device and backchannel grants depend on the store and approver
+		if !p.grantEnabled(gt) {
+			continue
+		}
+		grantTypes = append(grantTypes, gt)
+	}
+	if _, found := authorizeHandlers["token"]; found {
+		grantTypes = append(grantTypes, Implicit)
+	}
+	sort.Strings(responseTypes)
+	sort.Strings(grantTypes)
+
+	algs := []string{}
+	if alg := signingAlg(p.Tokenizer); alg != "" {
+		algs = append(algs, alg)
+	}
+	authMethods := []string{}
+	for m := range clientAuthenticators {
+		authMethods = append(authMethods, m)
+	}
+	sort.Strings(authMethods)
+	// public clients may revoke their tokens but not introspect them
+	introspectionMethods := []string{}
+	for _, m := range authMethods {
+		if m != None {
+			introspectionMethods = append(introspectionMethods, m)
+		}
+	}
+
+	md := &metadata{
+		Issuer:                        p.issuer(),
+		AuthorizationEndpoint:         p.endpoint("/authorize"),
+		TokenEndpoint:                 p.endpoint("/token"),
+		IntrospectionEndpoint:         p.endpoint("/introspect"),
+		RevocationEndpoint:            p.endpoint("/revoke"),
+		JWKSURI:                       p.endpoint("/jwks"),
+		ResponseTypesSupported:        responseTypes,
+		ResponseModesSupported:        []string{"query", "fragment"},
+		GrantTypesSupported:           grantTypes,
+		TokenEndpointAuthMethods:      authMethods,
+		TokenEndpointAuthSigningAlgs:  assertionAlgs,
+		IntrospectionAuthMethods:      introspectionMethods,
+		RevocationAuthMethods:         authMethods,
+		CodeChallengeMethodsSupported: []string{PKCEPlain, PKCES256},
+		SubjectTypesSupported:         []string{"public"},
+		IDTokenSigningAlgs:            algs,
+		DPoPSigningAlgs:               dpopAlgs,
+		RequestParameterSupported:     true,
+		RequestURIParameterSupported:  true,
+		RequestObjectSigningAlgs:      requestObjectAlgs,
+	}
+	// tokens are only bound to certificates the provider is configured to
+	// receive, either verified against its CAs or forwarded by a proxy
+	md.TLSCertificateBoundTokens = p.ClientCAs != nil || p.CertificateHeader != ""
+	// request objects are only fetched from request uris the client
+	// registered (see fetchRequestObject)
+	md.RequireRequestURIRegistration = md.RequestURIParameterSupported
+	if p.EncryptionKeys != nil {
+		for alg := range requestObjectEncAlgs {
+			md.RequestObjectEncryptionAlgs = append(md.RequestObjectEncryptionAlgs, alg)
+		}
+		for enc := range requestObjectEncs {
+			md.RequestObjectEncryptionEncs = append(md.RequestObjectEncryptionEncs, enc)
+		}
+		sort.Strings(md.RequestObjectEncryptionAlgs)
+		sort.Strings(md.RequestObjectEncryptionEncs)
+	}
+	for t := range p.AuthorizationDetailTypes {
+		md.AuthorizationDetailTypes = append(md.AuthorizationDetailTypes, t)
+	}
+	sort.Strings(md.AuthorizationDetailTypes)
+	if p.deviceStore() != nil {
+		md.DeviceAuthorizationEndpoint = p.endpoint("/device_authorization")
+	}
+	if p.pushedRequestStore() != nil {
+		md.PushedRequestEndpoint = p.endpoint("/par")
+	}
+	if p.backchannelStore() != nil {
+		md.BackchannelEndpoint = p.endpoint("/bc-authorize")
+		md.BackchannelDeliveryModes = []string{DeliveryPoll, DeliveryPing, DeliveryPush}
+	}
+	if p.ScopeRegistry != nil {
+		md.ScopesSupported = p.ScopeRegistry.Supported()
+	}
+	if p.Registrar != nil {
+		md.RegistrationEndpoint = p.endpoint("/register")
+	}
+	return md
+}
+
+func handleMetadata(ctx *context) error {
+	if ctx.request.Method != "GET" {
+		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+	ctx.json(http.StatusOK, ctx.provider.metadata())
+	return nil
+}
+
+func handleJWKS(ctx *context) error {
+	p := ctx.provider
+	if ctx.request.Method != "GET" {
+		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+	set := &JWKSet{Keys: []*JWK{}}
+	if p.Keys != nil {
+		pub, err := parsePublicKeyPEM(p.Keys.Verify)
+		if err != nil {
+			return err
+		}
+		k, err := NewJWK(pub)
+		if err != nil {
+			return err
+		}
+		k.Use = "sig"
+		k.Algorithm = signingAlg(p.Tokenizer)
+		set.Keys = append(set.Keys, k)
+	}
+	if p.EncryptionKeys != nil {
+		pub, err := parsePublicKeyPEM(p.EncryptionKeys.Verify)
+		if err != nil {
+			return err
+		}
+		k, err := NewJWK(pub)
+		if err != nil {
+			return err
+		}
+		k.Use = "enc"
+		k.Algorithm = "RSA-OAEP-256"
+		set.Keys = append(set.Keys, k)
+	}
+	ctx.json(http.StatusOK, set)
+	return nil
+}
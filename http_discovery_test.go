@@ -0,0 +1,122 @@
+package ohauth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	h := testProvider.Handler()
+	for _, path := range []string{"/.well-known/openid-configuration", "/.well-known/oauth-authorization-server"} {
+		r := httptest.NewRequest("GET", "https://authz.example.com"+path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		md := &metadata{}
+		if err := json.NewDecoder(w.Body).Decode(md); err != nil {
+			t.Fatal(err)
+		}
+		if md.Issuer != "https://authz.example.com" || md.TokenEndpoint != "https://authz.example.com/token" {
+			t.Fatalf("%s: unexpected endpoints: %+v", path, md)
+		}
+		grants := map[string]bool{}
+		for _, gt := range md.GrantTypesSupported {
+			grants[gt] = true
+		}
+		if !grants[AuthorizationCode] || !grants[RefreshToken] || !grants[Implicit] {
+			t.Fatalf("%s: missing grant types: %v", path, md.GrantTypesSupported)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	r := httptest.NewRequest("GET", "https://authz.example.com/jwks", nil)
+	w := httptest.NewRecorder()
+	testProvider.Handler().ServeHTTP(w, r)
+
+	set := &JWKSet{}
+	if err := json.NewDecoder(w.Body).Decode(set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].KeyType != "RSA" || set.Keys[0].Algorithm != "RS256" || set.Keys[0].Exponent != "AQAB" {
+		t.Fatalf("unexpected key set: %+v", set.Keys)
+	}
+}
+
+// basicStore only implements the methods every Store must have
+type basicStore struct {
+	Store
+}
+
+func TestMetadata_basicStore(t *testing.T) {
+	p := *testProvider
+	p.Store = &basicStore{testProvider.Store}
+	p.Approver = NewTestingApprover("alice")
+
+	md := p.metadata()
+	if md.DeviceAuthorizationEndpoint != "" || md.PushedRequestEndpoint != "" || md.BackchannelEndpoint != "" {
+		t.Fatalf("EXPECTED endpoints the store cannot serve to be left out - GOT = %+v", md)
+	}
+	for _, gt := range md.GrantTypesSupported {
+		if gt == DeviceCode || gt == CIBA {
+			t.Fatalf("EXPECTED %s to be left out - GOT = %v", gt, md.GrantTypesSupported)
+		}
+	}
+
+	h := p.Handler()
+	for _, path := range []string{"/device_authorization", "/device", "/par", "/bc-authorize"} {
+		r := httptest.NewRequest("POST", "https://authz.example.com"+path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("%s: EXPECTED = %d - GOT = %d", path, http.StatusNotFound, w.Code)
+		}
+	}
+}
+
+func TestMetadata_withoutKeys(t *testing.T) {
+	p := *testProvider
+	p.Keys = nil
+	p.Approver = NewTestingApprover("alice")
+
+	if md := p.metadata(); md.BackchannelEndpoint != "" || containsString(md.GrantTypesSupported, CIBA) {
+		t.Fatalf("EXPECTED backchannel authentication to be disabled without provider keys - GOT = %+v", md)
+	}
+	r := httptest.NewRequest("POST", "https://authz.example.com/bc-authorize", nil)
+	w := httptest.NewRecorder()
+	p.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("EXPECTED = %d - GOT = %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestMetadata_authMethods(t *testing.T) {
+	md := testProvider.metadata()
+	if !containsString(md.RevocationAuthMethods, None) || !containsString(md.TokenEndpointAuthMethods, None) {
+		t.Fatalf("EXPECTED public clients to use the token and revocation endpoints - GOT = %v %v", md.TokenEndpointAuthMethods, md.RevocationAuthMethods)
+	}
+	if containsString(md.IntrospectionAuthMethods, None) || len(md.IntrospectionAuthMethods) == 0 {
+		t.Fatalf("EXPECTED introspection methods without %s - GOT = %v", None, md.IntrospectionAuthMethods)
+	}
+}
+
+func TestMetadata_certificateBoundTokens(t *testing.T) {
+	p := *testProvider
+	p.ClientCAs = nil
+	p.CertificateHeader = ""
+	if p.metadata().TLSCertificateBoundTokens {
+		t.Fatal("EXPECTED certificate bound tokens to be unsupported without CAs or a certificate header")
+	}
+	p.CertificateHeader = "X-Client-Cert"
+	if !p.metadata().TLSCertificateBoundTokens {
+		t.Fatal("EXPECTED certificate bound tokens to be supported with a certificate header")
+	}
+	p.CertificateHeader = ""
+	p.ClientCAs = x509.NewCertPool()
+	if md := p.metadata(); !md.TLSCertificateBoundTokens || !md.RequireRequestURIRegistration {
+		t.Fatalf("EXPECTED certificate bound tokens and registered request uris - GOT = %+v", md)
+	}
+}
@@ -0,0 +1,150 @@
+package ohauth
+
+import (
+	"net/http"
+	"time"
+)
+
+// exchangeResponse is the token exchange response of rfc8693 section 2.2.1
+type exchangeResponse struct {
+	tokenResponse
+	IssuedTokenType string `json:"issued_token_type"`
+}
+
+// addressedTo determines if a token was issued to a client or presented to it
+// as its audience
+func addressedTo(tc *TokenClaims, c *Client) bool {
+	return tc.clientID() == c.ID || tc.Audience == c.ID
+}
+
+// grantWithTokenExchange issues a token for a downstream audience in exchange
+// for an access token held by the client (rfc8693). The issued token never
+// carries more scope or lives longer than the subject token, and records the
+// actor, if any, on top of any previous delegation chain.
+func grantWithTokenExchange(ctx *context, gr *grantRequest) error {
+	p := ctx.provider
+	c := gr.client
+	f := gr.form
+	policy, hasPolicy := p.Issuer.(ExchangePolicy)
+
+	if f.Get("subject_token_type") != AccessTokenType ||
+		f.Get("actor_token") != "" && f.Get("actor_token_type") != AccessTokenType ||
+		f.Get("requested_token_type") != "" && f.Get("requested_token_type") != AccessTokenType {
+		ctx.json(http.StatusBadRequest, ErrBadExchangeTokenType)
+		return nil
+	}
+
+	subject, _, err := activeToken(ctx, f.Get("subject_token"), c)
+	if err != nil {
+		return err
+	}
+	if subject == nil || subject.Role != RoleAccessToken {
+		ctx.json(http.StatusBadRequest, ErrBadSubjectToken)
+		return nil
+	}
+	// the caller must be the client the subject token was issued to or the
+	// audience it was presented to. Only a policy can tell which client serves
+	// a registered resource.
+	if !addressedTo(subject, c) {
+		if _, found := p.Resources[subject.Audience]; !found || !hasPolicy {
+			ctx.json(http.StatusBadRequest, ErrBadSubjectToken)
+			return nil
+		}
+	}
+
+	var actor *TokenClaims
+	if f.Get("actor_token") != "" {
+		actor, _, err = activeToken(ctx, f.Get("actor_token"), c)
+		if err != nil {
+			return err
+		}
+		if actor == nil || actor.Role != RoleAccessToken || !addressedTo(actor, c) {
+			ctx.json(http.StatusBadRequest, ErrBadActorToken)
+			return nil
+		}
+	}
+
+	// the issued token is addressed to another client, to a registered
+	// resource (rfc8693 section 2.1) or to the caller itself. A token has a
+	// single audience so both cannot be requested at once.
+	target := c
+	if aud := f.Get("audience"); aud != "" && aud != c.ID {
+		if len(f["resource"]) > 0 {
+			ctx.json(http.StatusBadRequest, ErrBadTarget)
+			return nil
+		}
+		if !hasPolicy {
+			ctx.json(http.StatusBadRequest, ErrBadTarget)
+			return nil
+		}
+		target, err = p.Store.FetchClient(aud)
+		if err != nil {
+			return err
+		}
+		if target == nil || target.Status != ClientActive {
+			ctx.json(http.StatusBadRequest, ErrBadTarget)
+			return nil
+		}
+	}
+
+	scope := subject.Scope
+	if f.Get("scope") != "" {
+		scope = ParseScope(f.Get("scope"))
+	}
+	validscope := p.ScopeHierarchy.Contains(subject.Scope, scope) &&
+		p.ScopeHierarchy.Contains(target.Scope, scope) &&
+		p.scopePermitted(c, scope, TokenExchange)
+	if !validscope {
+		ctx.json(http.StatusBadRequest, ErrScopeNotAllowed)
+		return nil
+	}
+
+	exp := ctx.timestamp.Add(p.expiryForToken(c, TokenExchange))
+	if limit := time.Unix(subject.Expires, 0); exp.After(limit) {
+		exp = limit
+	}
+
+	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, exp)
+	at.ID = randID()
+	at.Subject = subject.Subject
+	at.Issuer = p.issuer()
+	at.Scope = scope
+	at.Grant = TokenExchange
+	at.Actor = subject.Actor
+	if actor != nil {
+		at.Actor = &Actor{actor.Subject, subject.Actor}
+	}
+	if e := p.restrictToResource(at, c, nil, f["resource"]); e != nil {
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
+	if len(f["resource"]) == 0 {
+		at.Audience = target.ID
+	}
+	if hasPolicy && !policy.ExchangePermitted(c, subject, actor, at.Audience, at.Scope) {
+		ctx.json(http.StatusBadRequest, ErrScopeNotAllowed)
+		return nil
+	}
+
+	// the issued token belongs to the caller, which may revoke it, and its
+	// audience learns about it through introspection
+	tokenType := gr.bind(at)
+	sat, err := p.Tokenizer.Tokenize(at, c.Keys.Sign)
+	if err != nil {
+		return err
+	}
+
+	ctx.json(http.StatusOK, &exchangeResponse{
+		tokenResponse{
+			sat,
+			tokenType,
+			at.Expires - time.Now().Unix(),
+			"",
+			"",
+			at.AuthorizationDetails,
+		},
+		AccessTokenType,
+	})
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package ohauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// exchangeIssuer permits exchanges for a fixed set of audiences
+type exchangeIssuer struct {
+	Issuer
+	audiences []string
+}
+
+func (e *exchangeIssuer) ExchangePermitted(client *Client, subject, actor *TokenClaims, audience string, scope Scope) bool {
+	return containsString(e.audiences, audience)
+}
+
+func TestGrant_tokenExchange(t *testing.T) {
+	orders := "https://api.example.com/orders"
+	p := *testProvider
+	p.Resources = map[string]Scope{orders: ParseScope("orders")}
+
+	frontend := NewClient("Web App", Password, ClientCredentials, TokenExchange)
+	frontend.Scope = ParseScope("orders,profile")
+	api := NewClient("Orders API", TokenExchange)
+	api.Scope = ParseScope("orders")
+	service := NewClient("Orders Worker", ClientCredentials)
+	downstream := NewClient("Billing API", ClientCredentials)
+	downstream.Scope = ParseScope("orders")
+	public := NewPublicClient("Single Page App", TokenExchange)
+	for _, c := range []*Client{frontend, api, service, downstream, public} {
+		c.Status = ClientActive
+		if err := p.Store.CreateClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	grant := func(c *Client, form url.Values) (int, map[string]interface{}) {
+		form.Set("client_id", c.ID)
+		form.Set("client_secret", c.Secret)
+		r := httptest.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := handleGrant(&context{&p, w, r, time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]interface{}{}
+		if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, out
+	}
+	password := func(resource string) string {
+		form := url.Values{
+			"grant_type": {Password},
+			"username":   {"testuser"},
+			"password":   {"testpassword"},
+			"scope":      {"orders,profile"},
+		}
+		if resource != "" {
+			form.Set("resource", resource)
+		}
+		_, out := grant(frontend, form)
+		return out["access_token"].(string)
+	}
+	user := password("")
+	_, own := grant(frontend, url.Values{"grant_type": {ClientCredentials}})
+	_, foreign := grant(service, url.Values{"grant_type": {ClientCredentials}})
+	exchange := func(c *Client, subject, actor, audience, scope string) (int, map[string]interface{}) {
+		form := url.Values{
+			"grant_type":         {TokenExchange},
+			"subject_token":      {subject},
+			"subject_token_type": {AccessTokenType},
+			"audience":           {audience},
+			"scope":              {scope},
+		}
+		if actor != "" {
+			form.Set("actor_token", actor)
+			form.Set("actor_token_type", AccessTokenType)
+		}
+		return grant(c, form)
+	}
+
+	table := []struct {
+		name                            string
+		client                          *Client
+		subject, actor, audience, scope string
+		code                            string
+	}{
+		{"token of another client", api, user, "", "", "orders", InvalidGrant},
+		{"actor of another client", frontend, user, foreign["access_token"].(string), "", "orders", InvalidGrant},
+		{"audience without a policy", frontend, user, "", downstream.ID, "orders", InvalidTarget},
+		{"resource token without a policy", api, password(orders), "", "", "orders", InvalidGrant},
+		{"public client", public, user, "", "", "orders", InvalidRequest},
+	}
+	for _, r := range table {
+		if status, out := exchange(r.client, r.subject, r.actor, r.audience, r.scope); status != http.StatusBadRequest || out["error"] != r.code {
+			t.Fatalf("%s: EXPECTED = %s - GOT = %d %v", r.name, r.code, status, out)
+		}
+	}
+
+	status, out := exchange(frontend, user, "", "", "orders")
+	if status != http.StatusOK || out["issued_token_type"] != AccessTokenType {
+		t.Fatalf("exchange of own token failed: %d %v", status, out)
+	}
+
+	// a registered resource may be requested instead of an audience
+	resource := func(audience string) (int, map[string]interface{}) {
+		return grant(frontend, url.Values{
+			"grant_type":         {TokenExchange},
+			"subject_token":      {user},
+			"subject_token_type": {AccessTokenType},
+			"audience":           {audience},
+			"resource":           {orders},
+		})
+	}
+	if status, out := resource(downstream.ID); status != http.StatusBadRequest || out["error"] != InvalidTarget {
+		t.Fatalf("audience and resource: EXPECTED = %s - GOT = %d %v", InvalidTarget, status, out)
+	}
+	status, out = resource("")
+	if status != http.StatusOK {
+		t.Fatalf("exchange for a resource failed: %d %v", status, out)
+	}
+	tc, err := p.Tokenizer.Parse(out["access_token"].(string), frontend.Keys.Verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.Audience != orders || tc.ClientID != frontend.ID || !tc.Scope.Equals(ParseScope("orders")) {
+		t.Fatalf("unexpected claims of a token exchanged for a resource: %+v", tc)
+	}
+
+	p.Issuer = &exchangeIssuer{testProvider.Issuer, []string{downstream.ID, api.ID}}
+	if status, out := exchange(frontend, user, own["access_token"].(string), downstream.ID, "profile"); status != http.StatusBadRequest || out["error"] != InvalidScope {
+		t.Fatalf("exchange beyond downstream scope: %d %v", status, out)
+	}
+	status, out = exchange(frontend, user, own["access_token"].(string), downstream.ID, "orders")
+	if status != http.StatusOK {
+		t.Fatalf("exchange failed: %d %v", status, out)
+	}
+	tc, err = p.Tokenizer.Parse(out["access_token"].(string), frontend.Keys.Verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.Audience != downstream.ID || tc.ClientID != frontend.ID || tc.Subject != "testuser" || !tc.Scope.Equals(ParseScope("orders")) {
+		t.Fatalf("unexpected exchanged token claims: %+v", tc)
+	}
+	if tc.Actor == nil || tc.Actor.Subject != frontend.ID {
+		t.Fatalf("exchanged token does not name its actor: %+v", tc.Actor)
+	}
+	r := httptest.NewRequest("POST", "https://authz.example.com/introspect", nil)
+	res, err := introspect(&context{&p, httptest.NewRecorder(), r, time.Now()}, out["access_token"].(string), downstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Active || res.ClientID != frontend.ID {
+		t.Fatalf("EXPECTED audience to see a token of %s - GOT = %+v", frontend.ID, res)
+	}
+	form := url.Values{
+		"client_id":     {frontend.ID},
+		"client_secret": {frontend.Secret},
+		"token":         {out["access_token"].(string)},
+	}
+	r = httptest.NewRequest("POST", "https://authz.example.com/revoke", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := handleRevoke(&context{&p, httptest.NewRecorder(), r, time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if bl, err := p.Store.TokenBlacklisted(tc.ID); err != nil || !bl {
+		t.Fatalf("exchanged token was not revoked by its client: %v %v", bl, err)
+	}
+
+	if status, out := exchange(api, password(orders), "", "", "orders"); status != http.StatusOK {
+		t.Fatalf("resource token permitted by policy: %d %v", status, out)
+	}
+}
@@ -1,8 +1,6 @@
 package ohauth
 
 import (
-	"crypto/subtle"
-	"errors"
 	"net/http"
 	"net/url"
 	"time"
@@ -11,6 +9,22 @@ import (
 type grantRequest struct {
 	client *Client
 	form   url.Values
+	// jkt is the thumbprint of the DPoP proof key sent with the request and
+	// x5t the thumbprint of the client's TLS certificate
+	jkt string
+	x5t string
+}
+
+// bind binds an access token to the DPoP proof key and client certificate sent
+// with the request, if any, and returns the token type to respond with
+func (gr *grantRequest) bind(at *TokenClaims) string {
+	if gr.jkt != "" || gr.x5t != "" {
+		at.Confirmation = &Confirmation{gr.jkt, gr.x5t}
+	}
+	if gr.jkt == "" {
+		return "bearer"
+	}
+	return DPoPTokenType
 }
 
 type tokenResponse struct {
@@ -18,6 +32,10 @@ type tokenResponse struct {
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int64  `json:"expires_in"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// AuthorizationDetails are the authorization details granted to the
+	// access token (rfc9396 section 7)
+	AuthorizationDetails AuthorizationDetails `json:"authorization_details,omitempty"`
 }
 
 var grantHandlers = map[string]func(*context, *grantRequest) error{
@@ -25,22 +43,45 @@ var grantHandlers = map[string]func(*context, *grantRequest) error{
 	Password:          grantWithPassword,
 	ClientCredentials: grantWithClient,
 	RefreshToken:      grantWithRefreshToken,
+	DeviceCode:        grantWithDeviceCode,
+	JWTBearer:         grantWithAssertion,
+	TokenExchange:     grantWithTokenExchange,
+	CIBA:              grantWithBackchannel,
 }
 
-func grantWithCode(ctx *context, gr *grantRequest) error {
-	c := gr.client
+// issueRefreshToken creates a refresh token linked to an access token if the
+// client is allowed to use the refresh token grant, or an empty string if not.
+// The refresh token keeps the scope and resources of the grant which may be
+// broader than those of an access token issued for a single resource.
+func issueRefreshToken(ctx *context, c *Client, at *TokenClaims, scope Scope, resources []string) (string, error) {
 	p := ctx.provider
-	ru, err := ParseURL(gr.form.Get("redirect_uri"))
-	if err != nil {
-		ctx.json(http.StatusBadRequest, ErrBadRedirect)
-		return nil
+	if !c.AllowsGrant(RefreshToken) {
+		return "", nil
 	}
 
-	if c.RedirectURI.String() != ru.String() {
-		ctx.json(http.StatusBadRequest, ErrBadRedirect)
-		return nil
+	rt := NewTokenClaims(RoleRefreshToken, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, RefreshToken)))
+	rt.ID = randID()
+	rt.Audience = c.ID
+	rt.Subject = at.ID
+	rt.Owner = at.Subject
+	rt.GrantID = at.GrantID
+	rt.Issuer = p.issuer()
+	rt.Scope = scope
+	rt.Grant = at.Grant
+	rt.AuthorizationDetails = at.AuthorizationDetails
+	rt.Resources = resources
+	// refresh tokens of public clients are bound to the same key as the access
+	// token (rfc9449 section 5)
+	if c.IsPublic() {
+		rt.Confirmation = at.Confirmation
 	}
 
+	return p.Tokenizer.Tokenize(rt, c.Keys.Sign)
+}
+
+func grantWithCode(ctx *context, gr *grantRequest) error {
+	c := gr.client
+	p := ctx.provider
 	tc, err := p.Tokenizer.Parse(gr.form.Get("code"), c.Keys.Verify)
 	if err != nil {
 		return err
@@ -64,15 +105,39 @@ func grantWithCode(ctx *context, gr *grantRequest) error {
 		return nil
 	}
 
-	scope := c.Scope.Contains(tc.Scope) && p.Issuer.ScopePermitted(tc.Scope, c.GrantType)
+	// the redirect uri must be the one the code was delivered to. It may only
+	// be left out when it was left out of the authorization request.
+	if !redeemRedirect(c, tc, gr.form.Get("redirect_uri")) {
+		ctx.json(http.StatusBadRequest, ErrBadRedirect)
+		return nil
+	}
+
+	scope := p.ScopeHierarchy.Contains(c.Scope, tc.Scope) && p.scopePermitted(c, tc.Scope, AuthorizationCode)
 	if !scope {
 		ctx.json(http.StatusForbidden, ErrScopeNotAllowed)
 		return nil
 	}
 
+	// a code issued with a challenge can only be redeemed with the matching
+	// verifier and a verifier must not be sent for a code issued without one
+	verifier := gr.form.Get("code_verifier")
+	if tc.Challenge != "" && !verifyChallenge(tc.Challenge, tc.ChallengeMethod, verifier) ||
+		tc.Challenge == "" && verifier != "" {
+		ctx.json(http.StatusBadRequest, ErrVerifierMismatch)
+		return nil
+	}
+
+	// the client may ask for some of the authorization details granted with
+	// the code but never for others
+	details, ok := narrowDetails(tc.AuthorizationDetails, gr.form.Get("authorization_details"))
+	if !ok {
+		ctx.json(http.StatusBadRequest, ErrDetailsExceedGrant)
+		return nil
+	}
+
 	role := tc.Role == RoleCode
 	aud := tc.Audience == c.ID
-	iss := tc.Issuer == p.URL.String()
+	iss := p.issuedByProvider(tc.Issuer)
 	exp := tc.Expires > ctx.timestamp.Unix()
 	grant := tc.Grant == AuthorizationCode
 	if !role || !aud || !iss || !exp || !grant || !scope {
@@ -80,37 +145,54 @@ func grantWithCode(ctx *context, gr *grantRequest) error {
 		return nil
 	}
 
-	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.Issuer.ExpiryForToken(c.GrantType)))
+	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, AuthorizationCode)))
 	at.ID = randID()
-	at.Audience = c.ID
+	at.GrantID = randID()
 	at.Subject = tc.Subject
-	at.Issuer = p.URL.String()
+	at.Issuer = p.issuer()
 	at.Scope = tc.Scope
 	at.Grant = AuthorizationCode
+	at.AuthorizationDetails = details
+	if e := p.restrictToResource(at, c, tc.Resources, gr.form["resource"]); e != nil {
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
 
-	rt := NewTokenClaims(RoleRefreshToken, ctx.timestamp, ctx.timestamp.Add(p.Issuer.ExpiryForToken(RefreshToken)))
-	rt.ID = randID()
-	rt.Subject = at.ID
-	at.Issuer = p.URL.String()
-
+	tokenType := gr.bind(at)
 	sat, err := p.Tokenizer.Tokenize(at, c.Keys.Sign)
 	if err != nil {
 		return err
 	}
-	srt, err := p.Tokenizer.Tokenize(rt, c.Keys.Sign)
+	srt, err := issueRefreshToken(ctx, c, at, tc.Scope, tc.Resources)
 	if err != nil {
 		return err
 	}
 
+	sidt := ""
+	if tc.Scope[OpenID] {
+		sidt, err = p.signIDToken(newIDToken(ctx, c, tc, sat, gr.form.Get("code")))
+		// the code is not used up so that it can be redeemed once the
+		// provider keys are configured
+		if err == ErrNoProviderKeys {
+			ctx.json(http.StatusInternalServerError, ErrUnexpected)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	if err := p.Store.BlacklistToken(tc.ID); err != nil {
 		return err
 	}
 
 	ctx.json(http.StatusOK, &tokenResponse{
 		sat,
-		"bearer",
+		tokenType,
 		at.Expires - time.Now().Unix(),
 		srt,
+		sidt,
+		at.AuthorizationDetails,
 	})
 
 	return nil
@@ -119,7 +201,7 @@ func grantWithPassword(ctx *context, gr *grantRequest) error {
 	p := ctx.provider
 	c := gr.client
 	f := gr.form
-	scope := ParseScope(f.Get("scope"))
+	scope := p.requestedScope(c, f.Get("scope"))
 	username := f.Get("username")
 	password := f.Get("password")
 
@@ -132,39 +214,41 @@ func grantWithPassword(ctx *context, gr *grantRequest) error {
 		return nil
 	}
 
-	validscope := c.Scope.Contains(scope) && p.Issuer.ScopePermitted(scope, c.GrantType)
+	validscope := p.ScopeHierarchy.Contains(c.Scope, scope) && p.scopePermitted(c, scope, Password)
 	if !validscope {
 		ctx.json(http.StatusForbidden, ErrScopeNotAllowed)
 		return nil
 	}
 
-	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.Issuer.ExpiryForToken(c.GrantType)))
+	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, Password)))
 	at.ID = randID()
-	at.Audience = c.ID
+	at.GrantID = randID()
 	at.Subject = s.Subject
-	at.Issuer = p.URL.String()
+	at.Issuer = p.issuer()
 	at.Scope = scope
 	at.Grant = Password
+	if e := p.restrictToResource(at, c, nil, f["resource"]); e != nil {
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
 
-	rt := NewTokenClaims(RoleRefreshToken, ctx.timestamp, ctx.timestamp.Add(p.Issuer.ExpiryForToken(RefreshToken)))
-	rt.ID = randID()
-	rt.Subject = at.ID
-	at.Issuer = p.URL.String()
-
+	tokenType := gr.bind(at)
 	sat, err := p.Tokenizer.Tokenize(at, c.Keys.Sign)
 	if err != nil {
 		return err
 	}
-	srt, err := p.Tokenizer.Tokenize(rt, c.Keys.Sign)
+	srt, err := issueRefreshToken(ctx, c, at, scope, nil)
 	if err != nil {
 		return err
 	}
 
 	ctx.json(http.StatusOK, &tokenResponse{
 		sat,
-		"bearer",
+		tokenType,
 		at.Expires - time.Now().Unix(),
 		srt,
+		"",
+		at.AuthorizationDetails,
 	})
 
 	return nil
@@ -173,22 +257,32 @@ func grantWithClient(ctx *context, gr *grantRequest) error {
 	p := ctx.provider
 	c := gr.client
 	f := gr.form
-	scope := ParseScope(f.Get("scope"))
+	scope := p.requestedScope(c, f.Get("scope"))
 
-	validscope := c.Scope.Contains(scope) && p.Issuer.ScopePermitted(scope, c.GrantType)
+	validscope := p.ScopeHierarchy.Contains(c.Scope, scope) && p.scopePermitted(c, scope, ClientCredentials)
 	if !validscope {
 		ctx.json(http.StatusForbidden, ErrScopeNotAllowed)
 		return nil
 	}
+	details, ok := p.authorizationDetails(c, f.Get("authorization_details"))
+	if !ok {
+		ctx.json(http.StatusBadRequest, ErrBadAuthzDetails)
+		return nil
+	}
 
-	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.Issuer.ExpiryForToken(c.GrantType)))
+	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, ClientCredentials)))
 	at.ID = randID()
-	at.Audience = c.ID
 	at.Subject = c.ID
-	at.Issuer = p.URL.String()
+	at.Issuer = p.issuer()
 	at.Scope = scope
 	at.Grant = ClientCredentials
+	at.AuthorizationDetails = details
+	if e := p.restrictToResource(at, c, nil, f["resource"]); e != nil {
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
 
+	tokenType := gr.bind(at)
 	sat, err := p.Tokenizer.Tokenize(at, c.Keys.Sign)
 	if err != nil {
 		return err
@@ -196,19 +290,178 @@ func grantWithClient(ctx *context, gr *grantRequest) error {
 
 	ctx.json(http.StatusOK, &tokenResponse{
 		sat,
-		"bearer",
+		tokenType,
 		at.Expires - time.Now().Unix(),
 		"",
+		"",
+		at.AuthorizationDetails,
 	})
 
 	return nil
 }
 func grantWithRefreshToken(ctx *context, gr *grantRequest) error {
-	return errors.New("not implemented")
+	p := ctx.provider
+	c := gr.client
+	f := gr.form
+
+	rt, err := p.Tokenizer.Parse(f.Get("refresh_token"), c.Keys.Verify)
+	if err != nil {
+		ctx.json(http.StatusBadRequest, ErrInvalidRefreshToken)
+		return nil
+	}
+
+	role := rt.Role == RoleRefreshToken
+	aud := rt.Audience == c.ID
+	iss := p.issuedByProvider(rt.Issuer)
+	exp := rt.Expires > ctx.timestamp.Unix()
+	if !role || !aud || !iss || !exp {
+		ctx.json(http.StatusBadRequest, ErrInvalidRefreshToken)
+		return nil
+	}
+
+	bl, err := p.tokenRevoked(rt)
+	if err != nil {
+		return err
+	}
+	if bl {
+		ctx.json(http.StatusBadRequest, ErrInvalidRefreshToken)
+		return nil
+	}
+	if rt.Confirmation != nil && (rt.Confirmation.JWKThumbprint != gr.jkt || rt.Confirmation.X509Thumbprint != gr.x5t) {
+		ctx.json(http.StatusBadRequest, ErrInvalidRefreshToken)
+		return nil
+	}
+
+	// the client may ask for a narrower scope than the one originally granted
+	// but never a broader one
+	scope := rt.Scope
+	if f.Get("scope") != "" {
+		scope = ParseScope(f.Get("scope"))
+	}
+	if !p.ScopeHierarchy.Contains(rt.Scope, scope) {
+		ctx.json(http.StatusBadRequest, ErrScopeExceedsGrant)
+		return nil
+	}
+	validscope := p.ScopeHierarchy.Contains(c.Scope, scope) && p.scopePermitted(c, scope, RefreshToken)
+	if !validscope {
+		ctx.json(http.StatusForbidden, ErrScopeNotAllowed)
+		return nil
+	}
+	details, ok := narrowDetails(rt.AuthorizationDetails, f.Get("authorization_details"))
+	if !ok {
+		ctx.json(http.StatusBadRequest, ErrDetailsExceedGrant)
+		return nil
+	}
+
+	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, rt.Grant)))
+	at.ID = randID()
+	at.Subject = rt.Owner
+	at.Issuer = p.issuer()
+	at.Scope = scope
+	at.Grant = RefreshToken
+	at.GrantID = rt.grantID()
+	at.AuthorizationDetails = details
+	if e := p.restrictToResource(at, c, rt.Resources, f["resource"]); e != nil {
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
+
+	tokenType := gr.bind(at)
+	sat, err := p.Tokenizer.Tokenize(at, c.Keys.Sign)
+	if err != nil {
+		return err
+	}
+
+	// a rotated refresh token keeps the original grant, scope and expiry while
+	// the one that was used can no longer be redeemed
+	srt := ""
+	if p.rotateRefreshToken(c) {
+		nrt := *rt
+		nrt.ID = randID()
+		nrt.Issued = ctx.timestamp.Unix()
+		nrt.Subject = at.ID
+		nrt.GrantID = at.GrantID
+		srt, err = p.Tokenizer.Tokenize(&nrt, c.Keys.Sign)
+		if err != nil {
+			return err
+		}
+		if err := p.Store.BlacklistToken(rt.ID); err != nil {
+			return err
+		}
+	}
+
+	ctx.json(http.StatusOK, &tokenResponse{
+		sat,
+		tokenType,
+		at.Expires - time.Now().Unix(),
+		srt,
+		"",
+		at.AuthorizationDetails,
+	})
+
+	return nil
 }
 
-func handleGrant(ctx *context) error {
+// grantWithAssertion exchanges a JWT assertion for an access token (rfc7523
+// section 2.1). Assertions signed by the client itself with one of its
+// registered keys can only name the client as their subject, while assertions
+// from a trusted issuer may name any resource owner.
+func grantWithAssertion(ctx *context, gr *grantRequest) error {
 	p := ctx.provider
+	c := gr.client
+	f := gr.form
+	scope := p.requestedScope(c, f.Get("scope"))
+
+	a, err := verifyAssertion(ctx, f.Get("assertion"), func(iss, kid string) (interface{}, error) {
+		if iss == c.ID {
+			return jwksKey(c.JWKS, kid)
+		}
+		return jwksKey(p.TrustedIssuers[iss], kid)
+	})
+	if err != nil {
+		return err
+	}
+	if a == nil || a.Issuer == c.ID && a.Subject != c.ID {
+		ctx.json(http.StatusBadRequest, ErrBadAssertion)
+		return nil
+	}
+
+	validscope := p.ScopeHierarchy.Contains(c.Scope, scope) && p.scopePermitted(c, scope, JWTBearer)
+	if !validscope {
+		ctx.json(http.StatusForbidden, ErrScopeNotAllowed)
+		return nil
+	}
+
+	at := NewTokenClaims(RoleAccessToken, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, JWTBearer)))
+	at.ID = randID()
+	at.Subject = a.Subject
+	at.Issuer = p.issuer()
+	at.Scope = scope
+	at.Grant = JWTBearer
+	if e := p.restrictToResource(at, c, nil, f["resource"]); e != nil {
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
+
+	tokenType := gr.bind(at)
+	sat, err := p.Tokenizer.Tokenize(at, c.Keys.Sign)
+	if err != nil {
+		return err
+	}
+
+	ctx.json(http.StatusOK, &tokenResponse{
+		sat,
+		tokenType,
+		at.Expires - time.Now().Unix(),
+		"",
+		"",
+		at.AuthorizationDetails,
+	})
+
+	return nil
+}
+
+func handleGrant(ctx *context) error {
 	if ctx.request.Method != "POST" {
 		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
 		return nil
@@ -220,29 +473,44 @@ func handleGrant(ctx *context) error {
 	f := ctx.request.PostForm
 	gt := f.Get("grant_type")
 	handler, found := grantHandlers[gt]
-	if !found {
+	if !found || !ctx.provider.grantEnabled(gt) {
 		ctx.json(http.StatusBadRequest, ErrInvalidGrant)
 		return nil
 	}
 
-	client, err := p.Store.FetchClient(f.Get("client_id"))
+	client, err := ctx.authenticateClient()
 	if err != nil {
 		return err
 	}
-	if client == nil || client.Status != ClientActive {
-		ctx.json(http.StatusBadRequest, ErrClientNotFound)
+	if client == nil {
+		ctx.failClientAuth()
 		return nil
 	}
 
-	if gt != client.GrantType && gt != RefreshToken {
+	// public clients cannot be trusted to act on their own behalf or on behalf
+	// of others
+	if !client.AllowsGrant(gt) || client.IsPublic() && (gt == ClientCredentials || gt == TokenExchange) {
 		ctx.json(http.StatusBadRequest, ErrInvalidGrant)
 		return nil
 	}
 
-	if subtle.ConstantTimeCompare([]byte(f.Get("client_secret")), []byte(client.Secret)) != 1 {
-		ctx.json(http.StatusForbidden, ErrAccessDenied)
+	jkt, e, err := ctx.dpopBinding(client)
+	if err == ErrNoProviderKeys {
+		ctx.json(http.StatusInternalServerError, ErrUnexpected)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if e != nil {
+		ctx.json(http.StatusBadRequest, e)
 		return nil
 	}
 
-	return handler(ctx, &grantRequest{client, f})
+	x5t := ""
+	if certs := ctx.clientCertificates(); len(certs) > 0 {
+		x5t = CertificateThumbprint(certs[0])
+	}
+
+	return handler(ctx, &grantRequest{client, f, jkt, x5t})
 }
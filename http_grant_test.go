@@ -0,0 +1,155 @@
+package ohauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postGrant(t *testing.T, form url.Values) (int, map[string]interface{}) {
+	r, err := http.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if err := handleGrant(&context{testProvider, w, r, time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]interface{}{}
+	if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, out
+}
+
+func TestGrant_refreshToken(t *testing.T) {
+	client := NewClient("Test Client", Password)
+	client.Scope = ParseScope("openid,email,profile")
+	client.Status = ClientActive
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	status, out := postGrant(t, url.Values{
+		"grant_type":    {Password},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"username":      {"testuser"},
+		"password":      {"testpassword"},
+		"scope":         {"openid,email"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("password grant failed: %d %v", status, out)
+	}
+	rt := out["refresh_token"].(string)
+
+	table := []struct {
+		scope  string
+		status int
+		code   string
+	}{
+		{"", http.StatusOK, ""},
+		{"email", http.StatusOK, ""},
+		{"openid,email,profile", http.StatusBadRequest, InvalidScope},
+	}
+	for _, r := range table {
+		status, out := postGrant(t, url.Values{
+			"grant_type":    {RefreshToken},
+			"client_id":     {client.ID},
+			"client_secret": {client.Secret},
+			"refresh_token": {rt},
+			"scope":         {r.scope},
+		})
+		if status != r.status || (r.code != "" && out["error"] != r.code) {
+			t.Fatalf("scope %q: GOT = %d %v - EXPECTED = %d %s", r.scope, status, out, r.status, r.code)
+		}
+		if r.status != http.StatusOK {
+			continue
+		}
+		at, err := testProvider.Tokenizer.Parse(out["access_token"].(string), client.Keys.Verify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at.Subject != "testuser" || at.Role != RoleAccessToken {
+			t.Fatalf("unexpected access token claims: %+v", at)
+		}
+	}
+
+	rtc, err := testProvider.Tokenizer.Parse(rt, client.Keys.Verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testProvider.Store.BlacklistToken(rtc.ID); err != nil {
+		t.Fatal(err)
+	}
+	status, out = postGrant(t, url.Values{
+		"grant_type":    {RefreshToken},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"refresh_token": {rt},
+	})
+	if status != http.StatusBadRequest || out["error"] != InvalidGrant {
+		t.Fatalf("blacklisted refresh token was accepted: %d %v", status, out)
+	}
+}
+
+func TestGrant_publicClient(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	client := NewPublicClient("Single Page App", AuthorizationCode, RefreshToken)
+	client.Scope = ParseScope("email")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://spa.example.com/cb")}
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	session := &TokenClaims{Subject: "testuser"}
+	r, err := http.NewRequest("POST", "https://authz.example.com/authorize", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	err = authorizeWithCode(&context{testProvider, w, r, time.Now()}, &authorizationRequest{
+		client, session, client.RedirectURIs[0], true, client.Scope, "state", true, "", "", "", nil, nil, nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := w.Header().Get("Location"); !strings.Contains(loc, "error="+InvalidRequest) {
+		t.Fatalf("code was issued to a public client without a challenge: %s", loc)
+	}
+
+	code := issueCode(t, &authorizationRequest{
+		client, session, client.RedirectURIs[0], true, client.Scope, "state", true, challenge, PKCES256, "", nil, nil, nil,
+	})
+	status, out := postGrant(t, url.Values{
+		"grant_type":    {AuthorizationCode},
+		"client_id":     {client.ID},
+		"redirect_uri":  {client.RedirectURIs[0].String()},
+		"code":          {code},
+		"code_verifier": {verifier},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("EXPECTED = %d - GOT = %d %v", http.StatusOK, status, out)
+	}
+	if exp := out["expires_in"].(float64); exp > time.Hour.Seconds() {
+		t.Fatalf("public client token lifetime is too long: %v", exp)
+	}
+
+	rt := out["refresh_token"].(string)
+	status, out = postGrant(t, url.Values{"grant_type": {RefreshToken}, "client_id": {client.ID}, "refresh_token": {rt}})
+	if status != http.StatusOK || out["refresh_token"] == nil || out["refresh_token"] == rt {
+		t.Fatalf("refresh token was not rotated: %d %v", status, out)
+	}
+	status, out = postGrant(t, url.Values{"grant_type": {RefreshToken}, "client_id": {client.ID}, "refresh_token": {rt}})
+	if status != http.StatusBadRequest {
+		t.Fatalf("rotated refresh token was accepted again: %d %v", status, out)
+	}
+}
@@ -0,0 +1,153 @@
+package ohauth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// IntrospectionJWT is the media type of signed introspection responses as
+// defined in rfc9701
+const IntrospectionJWT = "application/token-introspection+jwt"
+
+// introspectionResponse carries the fields defined in rfc7662 section 2.2
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     Scope  `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Expires   int64  `json:"exp,omitempty"`
+	Issued    int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	Actor     *Actor `json:"act,omitempty"`
+
+	Confirmation         *Confirmation        `json:"cnf,omitempty"`
+	AuthorizationDetails AuthorizationDetails `json:"authorization_details,omitempty"`
+}
+
+// activeToken verifies an access or refresh token issued by the provider and
+// checks that it is unexpired and has not been revoked. Nil claims are returned
+// for tokens that are not active.
+func activeToken(ctx *context, raw string, fallback *Client) (*TokenClaims, *Client, error) {
+	p := ctx.provider
+	tc, client, err := ctx.parseToken(raw, fallback)
+	if err != nil || tc == nil {
+		return nil, nil, err
+	}
+	if client.Status != ClientActive {
+		return nil, nil, nil
+	}
+	if tc.Role != RoleAccessToken && tc.Role != RoleRefreshToken {
+		return nil, nil, nil
+	}
+
+	iss := p.issuedByProvider(tc.Issuer)
+	exp := tc.Expires > ctx.timestamp.Unix()
+	if !iss || !exp {
+		return nil, nil, nil
+	}
+
+	bl, err := p.tokenRevoked(tc)
+	if err != nil || bl {
+		return nil, nil, err
+	}
+	return tc, client, nil
+}
+
+// introspect determines whether a token is active and describes it. Codes and
+// identity tokens are never reported as active and neither are tokens the
+// caller may not learn about.
+func introspect(ctx *context, raw string, caller *Client) (*introspectionResponse, error) {
+	tc, client, err := activeToken(ctx, raw, caller)
+	if err != nil {
+		return nil, err
+	}
+	if tc == nil || !ctx.provider.introspectionPermitted(caller, tc) {
+		return &introspectionResponse{Active: false}, nil
+	}
+
+	subject := tc.Subject
+	if tc.Role == RoleRefreshToken {
+		subject = tc.Owner
+	}
+
+	return &introspectionResponse{
+		Active:    true,
+		Scope:     tc.Scope,
+		ClientID:  client.ID,
+		TokenType: tc.Role,
+		Expires:   tc.Expires,
+		Issued:    tc.Issued,
+		Subject:   subject,
+		Audience:  tc.Audience,
+		Issuer:    tc.Issuer,
+		ID:        tc.ID,
+		Actor:     tc.Actor,
+
+		Confirmation:         tc.Confirmation,
+		AuthorizationDetails: tc.AuthorizationDetails,
+	}, nil
+}
+
+func handleIntrospect(ctx *context) error {
+	p := ctx.provider
+	if ctx.request.Method != "POST" {
+		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+	if err := ctx.request.ParseForm(); err != nil {
+		return err
+	}
+
+	caller, err := ctx.authenticateClient()
+	if err != nil {
+		return err
+	}
+	// public clients cannot prove their identity so they are not allowed to
+	// inspect tokens
+	if caller == nil || caller.IsPublic() {
+		ctx.failClientAuth()
+		return nil
+	}
+
+	raw := ctx.request.PostForm.Get("token")
+	if raw == "" {
+		ctx.json(http.StatusBadRequest, ErrMissingToken)
+		return nil
+	}
+
+	// a signed response is never downgraded to a plain one since the caller
+	// asked to be able to verify it
+	sign := strings.Contains(ctx.request.Header.Get("Accept"), IntrospectionJWT)
+	if sign && p.Keys == nil {
+		ctx.abort(http.StatusNotAcceptable, "Not acceptable")
+		return nil
+	}
+
+	res, err := introspect(ctx, raw, caller)
+	if err != nil {
+		return err
+	}
+
+	if !sign {
+		ctx.json(http.StatusOK, res)
+		return nil
+	}
+
+	signed, err := signClaims(jwt.SigningMethodRS256, "token-introspection+jwt", map[string]interface{}{
+		"iss":                 p.issuer(),
+		"aud":                 caller.ID,
+		"iat":                 ctx.timestamp.Unix(),
+		"token_introspection": res,
+	}, p.Keys.Sign)
+	if err != nil {
+		return err
+	}
+	ctx.writer.Header().Set("Content-Type", IntrospectionJWT)
+	ctx.abort(http.StatusOK, signed)
+	return nil
+}
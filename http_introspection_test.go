@@ -0,0 +1,201 @@
+package ohauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// resourceServerIssuer marks a fixed set of clients as resource servers
+type resourceServerIssuer struct {
+	Issuer
+	servers []string
+}
+
+func (r *resourceServerIssuer) ResourceServer(client *Client) bool {
+	return containsString(r.servers, client.ID)
+}
+
+func postIntrospect(t *testing.T, p *Provider, form url.Values, accept string) *httptest.ResponseRecorder {
+	r, err := http.NewRequest("POST", "https://authz.example.com/introspect", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	if err := handleIntrospect(&context{p, w, r, time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestIntrospect(t *testing.T) {
+	client := NewClient("Test Client", ClientCredentials)
+	client.Scope = ParseScope("orders")
+	client.Status = ClientActive
+	rs := NewClient("Resource Server", ClientCredentials)
+	rs.Status = ClientActive
+	for _, c := range []*Client{client, rs} {
+		if err := testProvider.Store.CreateClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := *testProvider
+	p.Issuer = &resourceServerIssuer{testProvider.Issuer, []string{rs.ID}}
+
+	status, out := postGrant(t, url.Values{
+		"grant_type":    {ClientCredentials},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"scope":         {"orders"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("client credentials grant failed: %d %v", status, out)
+	}
+	at := out["access_token"].(string)
+	form := url.Values{
+		"client_id":     {rs.ID},
+		"client_secret": {rs.Secret},
+		"token":         {at},
+	}
+
+	res := map[string]interface{}{}
+	w := postIntrospect(t, &p, form, "application/json")
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res["active"] != true || res["client_id"] != client.ID || res["scope"] != "orders" {
+		t.Fatalf("unexpected introspection response: %v", res)
+	}
+
+	w = postIntrospect(t, &p, form, IntrospectionJWT)
+	if ct := w.Header().Get("Content-Type"); ct != IntrospectionJWT {
+		t.Fatalf("EXPECTED = %s - GOT = %s", IntrospectionJWT, ct)
+	}
+	parts := strings.Split(w.Body.String(), ".")
+	if len(parts) != 3 {
+		t.Fatalf("response is not a JWT: %s", w.Body.String())
+	}
+	payload, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(payload), `"active":true`) {
+		t.Fatalf("signed response does not describe an active token: %s", payload)
+	}
+
+	tc, err := testProvider.Tokenizer.Parse(at, client.Keys.Verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testProvider.Store.BlacklistToken(tc.ID); err != nil {
+		t.Fatal(err)
+	}
+	res = map[string]interface{}{}
+	w = postIntrospect(t, &p, form, "application/json")
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res["active"] != false || len(res) != 1 {
+		t.Fatalf("blacklisted token reported as active: %v", res)
+	}
+
+	form.Set("client_secret", "wrong")
+	if w := postIntrospect(t, &p, form, "application/json"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("EXPECTED = %d - GOT = %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestIntrospect_permitted(t *testing.T) {
+	client := NewClient("Test Client", Password)
+	client.Scope = ParseScope("email")
+	client.Status = ClientActive
+	other := NewClient("Other Client", ClientCredentials)
+	other.Status = ClientActive
+	rs := NewClient("Resource Server", ClientCredentials)
+	rs.Status = ClientActive
+	for _, c := range []*Client{client, other, rs} {
+		if err := testProvider.Store.CreateClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := *testProvider
+	p.Issuer = &resourceServerIssuer{testProvider.Issuer, []string{rs.ID}}
+
+	status, out := postGrant(t, url.Values{
+		"grant_type":    {Password},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"username":      {"testuser"},
+		"password":      {"testpassword"},
+		"scope":         {"email"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("password grant failed: %d %v", status, out)
+	}
+
+	cases := []struct {
+		caller *Client
+		token  string
+		active bool
+	}{
+		{client, "access_token", true},
+		{client, "refresh_token", true},
+		{rs, "access_token", true},
+		{rs, "refresh_token", false},
+		{other, "access_token", false},
+		{other, "refresh_token", false},
+	}
+	for _, c := range cases {
+		form := url.Values{
+			"client_id":     {c.caller.ID},
+			"client_secret": {c.caller.Secret},
+			"token":         {out[c.token].(string)},
+		}
+		res := map[string]interface{}{}
+		w := postIntrospect(t, &p, form, "application/json")
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res["active"] != c.active {
+			t.Fatalf("%s introspecting %s: EXPECTED active = %t - GOT = %v", c.caller.DisplayName, c.token, c.active, res)
+		}
+		if !c.active && len(res) != 1 {
+			t.Fatalf("%s introspecting %s: EXPECTED nothing but active - GOT = %v", c.caller.DisplayName, c.token, res)
+		}
+	}
+}
+
+func TestIntrospect_jwtWithoutKeys(t *testing.T) {
+	client := NewClient("Test Client", ClientCredentials)
+	client.Status = ClientActive
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	status, out := postGrant(t, url.Values{
+		"grant_type":    {ClientCredentials},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("client credentials grant failed: %d %v", status, out)
+	}
+
+	p := *testProvider
+	p.Keys = nil
+	form := url.Values{
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"token":         {out["access_token"].(string)},
+	}
+	if w := postIntrospect(t, &p, form, IntrospectionJWT); w.Code != http.StatusNotAcceptable {
+		t.Fatalf("EXPECTED = %d - GOT = %d %s", http.StatusNotAcceptable, w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,98 @@
+package ohauth
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// pushedRequestResponse is defined in rfc9126 section 2.2
+type pushedRequestResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
+
+// client authentication parameters are not part of a pushed request
+var clientAuthParams = []string{"client_secret", "client_assertion", "client_assertion_type"}
+
+func handlePushedRequest(ctx *context) error {
+	p := ctx.provider
+	ps := p.pushedRequestStore()
+	if ps == nil {
+		ctx.abort(http.StatusNotFound, "Not found")
+		return nil
+	}
+	if ctx.request.Method != "POST" {
+		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+	if err := ctx.request.ParseForm(); err != nil {
+		return err
+	}
+
+	c, err := ctx.authenticateClient()
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		ctx.failClientAuth()
+		return nil
+	}
+
+	params := url.Values{}
+	for k, v := range ctx.request.PostForm {
+		if !containsString(clientAuthParams, k) {
+			params[k] = v
+		}
+	}
+	params.Set("client_id", c.ID)
+	if params.Get("request_uri") != "" {
+		ctx.json(http.StatusBadRequest, ErrBadPushedRequest)
+		return nil
+	}
+
+	// the request is validated as it would be at the authorization endpoint
+	// so that the client learns about errors straight away. A request object
+	// is stored as it was pushed and verified again when it is used.
+	q := params
+	if params.Get("request") != "" {
+		q, _ = verifyRequestObject(ctx, c, params.Get("request"))
+		if q == nil {
+			ctx.json(http.StatusBadRequest, ErrBadRequestObject)
+			return nil
+		}
+	}
+	_, found := authorizeHandlers[q.Get("response_type")]
+	if !found || !c.AllowsResponseType(q.Get("response_type")) {
+		ctx.json(http.StatusBadRequest, ErrBadPushedRequest)
+		return nil
+	}
+	if q.Get("request_uri") != "" || c.MatchRedirectURI(q.Get("redirect_uri")) == nil {
+		ctx.json(http.StatusBadRequest, ErrBadPushedRequest)
+		return nil
+	}
+	scope := p.requestedScope(c, q.Get("scope"))
+	if !p.ScopeHierarchy.Contains(c.Scope, scope) || !p.scopePermitted(c, scope, responseGrant(q.Get("response_type"))) {
+		ctx.json(http.StatusBadRequest, ErrScopeNotAllowed)
+		return nil
+	}
+	if _, ok := p.requestedResources(q); !ok {
+		ctx.json(http.StatusBadRequest, ErrBadResource)
+		return nil
+	}
+	if _, ok := p.authorizationDetails(c, q.Get("authorization_details")); !ok {
+		ctx.json(http.StatusBadRequest, ErrBadAuthzDetails)
+		return nil
+	}
+
+	pr := NewPushedRequest(c.ID, params, ctx.timestamp, ctx.timestamp.Add(pushedRequestExpiry))
+	if err := ps.StorePushedRequest(pr); err != nil {
+		return err
+	}
+
+	ctx.json(http.StatusCreated, &pushedRequestResponse{
+		pr.RequestURI,
+		int64(pr.Expires.Sub(ctx.timestamp) / time.Second),
+	})
+	return nil
+}
@@ -0,0 +1,132 @@
+package ohauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushedAuthorizationRequest(t *testing.T) {
+	p := *testProvider
+	p.Authenticator = &subjectAuthenticator{testProvider.Authenticator, "paruser"}
+
+	client := NewClient("Test Client", AuthorizationCode)
+	client.Scope = ParseScope("email,profile")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://example.com/cb")}
+	client.RequirePushedRequests = true
+	if err := p.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(h func(*context) error, method, path string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "https://authz.example.com"+path, strings.NewReader(form.Encode()))
+		if method == "GET" {
+			r = httptest.NewRequest(method, "https://authz.example.com"+path+"?"+form.Encode(), nil)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := h(&context{&p, w, r, time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	params := url.Values{
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://example.com/cb"},
+		"scope":         {"email"},
+		"state":         {"pushed"},
+	}
+
+	bad := url.Values{}
+	for k, v := range params {
+		bad[k] = v
+	}
+	bad.Set("redirect_uri", "https://evil.example.com/cb")
+	if w := do(handlePushedRequest, "POST", "/par", bad); w.Code != http.StatusBadRequest {
+		t.Fatalf("unregistered redirect: EXPECTED = %d - GOT = %d", http.StatusBadRequest, w.Code)
+	}
+	bad.Set("redirect_uri", "https://example.com/cb")
+	bad.Set("scope", "email,profile")
+	p.ScopeRegistry = NewScopeRegistry(map[string]*ScopeDefinition{"email": {}})
+	if w := do(handlePushedRequest, "POST", "/par", bad); w.Code != http.StatusBadRequest {
+		t.Fatalf("unregistered scope: EXPECTED = %d - GOT = %d", http.StatusBadRequest, w.Code)
+	}
+	p.ScopeRegistry = nil
+
+	w := do(handlePushedRequest, "POST", "/par", params)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("EXPECTED = %d - GOT = %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	res := &pushedRequestResponse{}
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(res.RequestURI, RequestURIPrefix) || res.ExpiresIn <= 0 {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+
+	// loose parameters are ignored in favour of the pushed ones and are not
+	// passed on to the dialog
+	w = do(handleAuthorize, "GET", "/authorize", url.Values{
+		"client_id":   {client.ID},
+		"request_uri": {res.RequestURI},
+		"scope":       {"email,profile"},
+	})
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Path != "/dialog" || loc.Query().Get("scope") != "" || loc.Query().Get("request_uri") != res.RequestURI {
+		t.Fatalf("EXPECTED redirect to dialog - GOT = %s", loc)
+	}
+
+	w = do(handleAuthorize, "POST", "/authorize", url.Values{
+		"client_id":   {client.ID},
+		"request_uri": {res.RequestURI},
+		"scope":       {"email,profile"},
+	})
+	loc, err = url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := p.Tokenizer.Parse(loc.Query().Get("code"), client.Keys.Verify)
+	if err != nil {
+		t.Fatalf("EXPECTED code - GOT = %s %v", loc, err)
+	}
+	if !code.Scope.Equals(ParseScope("email")) || loc.Query().Get("state") != "pushed" {
+		t.Fatalf("code was not issued for the pushed request: %s %v", loc, code.Scope)
+	}
+
+	// the request uri cannot be used for a second response
+	w = do(handleAuthorize, "POST", "/authorize", url.Values{
+		"client_id":   {client.ID},
+		"request_uri": {res.RequestURI},
+	})
+	if loc := w.Header().Get("Location"); !strings.Contains(loc, "error="+InvalidRequest) || strings.Contains(loc, "code=") {
+		t.Fatalf("EXPECTED used request uri to be refused - GOT = %s", loc)
+	}
+
+	w = do(handleAuthorize, "GET", "/authorize", url.Values{
+		"client_id":     {client.ID},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://example.com/cb"},
+		"scope":         {"email"},
+	})
+	if loc := w.Header().Get("Location"); !strings.Contains(loc, "error="+InvalidRequest) {
+		t.Fatalf("EXPECTED pushed request to be required - GOT = %s", loc)
+	}
+	w = do(handleAuthorize, "GET", "/authorize", url.Values{
+		"client_id":   {"other"},
+		"request_uri": {res.RequestURI},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("request uri of another client: EXPECTED = %d - GOT = %d", http.StatusBadRequest, w.Code)
+	}
+}
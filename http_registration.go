@@ -0,0 +1,354 @@
+package ohauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// clientMetadata holds the client metadata values defined in rfc7591 section 2
+type clientMetadata struct {
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	ApplicationType         string   `json:"application_type,omitempty"`
+	ClientName              string   `json:"client_name,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+	JWKS                    *JWKSet  `json:"jwks,omitempty"`
+	DPoPBoundAccessTokens   bool     `json:"dpop_bound_access_tokens,omitempty"`
+	TLSSubjectDN            string   `json:"tls_client_auth_subject_dn,omitempty"`
+	TLSSANDNS               string   `json:"tls_client_auth_san_dns,omitempty"`
+	RequirePushedRequests   bool     `json:"require_pushed_authorization_requests,omitempty"`
+	RequireSignedRequests   bool     `json:"require_signed_request_object,omitempty"`
+	RequestURIs             []string `json:"request_uris,omitempty"`
+	DetailTypes             []string `json:"authorization_details_types,omitempty"`
+	DeliveryMode            string   `json:"backchannel_token_delivery_mode,omitempty"`
+	NotificationEndpoint    string   `json:"backchannel_client_notification_endpoint,omitempty"`
+	SoftwareStatement       string   `json:"software_statement,omitempty"`
+}
+
+// registrationResponse carries the client information response defined in
+// rfc7591 section 3.2.1 and rfc7592 section 3
+type registrationResponse struct {
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	IssuedAt                int64  `json:"client_id_issued_at"`
+	SecretExpiresAt         int64  `json:"client_secret_expires_at"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+	clientMetadata
+}
+
+func hashRegistrationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// metadataForClient describes a registered client using rfc7591 metadata
+func metadataForClient(c *Client) clientMetadata {
+	md := clientMetadata{
+		TokenEndpointAuthMethod: c.TokenEndpointAuthMethod,
+		GrantTypes:              c.GrantTypes,
+		ResponseTypes:           c.ResponseTypes,
+		ApplicationType:         c.ApplicationType,
+		ClientName:              c.DisplayName,
+		Scope:                   c.Scope.String(),
+		JWKS:                    c.JWKS,
+		DPoPBoundAccessTokens:   c.RequireDPoP,
+		TLSSubjectDN:            c.TLSSubjectDN,
+		TLSSANDNS:               c.TLSSANDNS,
+		RequirePushedRequests:   c.RequirePushedRequests,
+		RequireSignedRequests:   c.RequireSignedRequests,
+		RequestURIs:             c.RequestURIs,
+		DetailTypes:             c.AuthorizationDetailTypes,
+		DeliveryMode:            c.BackchannelDeliveryMode,
+		NotificationEndpoint:    c.BackchannelNotificationEndpoint,
+	}
+	if md.TokenEndpointAuthMethod == "" {
+		md.TokenEndpointAuthMethod = ClientSecretBasic
+	}
+	if md.ApplicationType == "" {
+		md.ApplicationType = WebApplication
+	}
+	for _, u := range c.RedirectURIs {
+		md.RedirectURIs = append(md.RedirectURIs, u.String())
+	}
+	return md
+}
+
+// applyMetadata validates client metadata and sets it on a client. Values
+// asserted by a software statement take precedence over the plain values.
+func applyMetadata(p *Provider, c *Client, md *clientMetadata) *Error {
+	if md.SoftwareStatement != "" {
+		claims, err := p.Registrar.VerifySoftwareStatement(md.SoftwareStatement)
+		if err != nil {
+			return ErrBadSoftwareStatement
+		}
+		b, err := json.Marshal(claims)
+		if err != nil {
+			return ErrBadSoftwareStatement
+		}
+		if err := json.Unmarshal(b, md); err != nil {
+			return ErrBadSoftwareStatement
+		}
+	}
+
+	// rfc7591 defaults to the authorization code grant and the response types
+	// default to those used by the requested grant types
+	grantTypes := uniqueStrings(md.GrantTypes)
+	if len(grantTypes) == 0 {
+		grantTypes = []string{AuthorizationCode}
+	}
+	for _, gt := range grantTypes {
+		if _, found := grantHandlers[gt]; !found && gt != Implicit {
+			return ErrBadClientMetadata
+		}
+	}
+	responseTypes := uniqueStrings(md.ResponseTypes)
+	if len(responseTypes) == 0 {
+		responseTypes = responseTypesFor(grantTypes)
+	}
+	for _, rt := range responseTypes {
+		if !containsString(responseTypesFor(grantTypes), rt) {
+			return ErrBadClientMetadata
+		}
+	}
+
+	// dynamically registered clients are never first-party
+	c.FirstParty = false
+	scope := ParseScope(md.Scope)
+	if !p.registrationPermitted(c, grantTypes, scope) {
+		return ErrBadClientMetadata
+	}
+
+	method := md.TokenEndpointAuthMethod
+	if method == "" {
+		method = ClientSecretBasic
+	}
+	if _, found := clientAuthenticators[method]; !found {
+		return ErrBadClientMetadata
+	}
+	if method == PrivateKeyJWT && (md.JWKS == nil || len(md.JWKS.Keys) == 0) {
+		return ErrBadClientMetadata
+	}
+	if method == None && containsString(grantTypes, ClientCredentials) {
+		return ErrBadClientMetadata
+	}
+	// exactly one certificate subject identifies a tls_client_auth client
+	// (rfc8705 section 2.1.2)
+	if method == TLSClientAuth && (md.TLSSubjectDN == "") == (md.TLSSANDNS == "") {
+		return ErrBadClientMetadata
+	}
+	if method == SelfSignedTLSClientAuth && (md.JWKS == nil || len(md.JWKS.Keys) == 0) {
+		return ErrBadClientMetadata
+	}
+
+	appType := md.ApplicationType
+	if appType == "" {
+		appType = WebApplication
+	}
+	parse, found := redirectPolicies[appType]
+	if !found {
+		return ErrBadClientMetadata
+	}
+	rus := []*StrictURL{}
+	for _, raw := range uniqueStrings(md.RedirectURIs) {
+		u, err := parse(raw)
+		if err != nil {
+			return ErrBadRegisteredRedirect
+		}
+		rus = append(rus, u)
+	}
+	if len(rus) == 0 && len(responseTypes) > 0 {
+		return ErrBadRegisteredRedirect
+	}
+
+	for _, raw := range md.RequestURIs {
+		if u, err := url.Parse(raw); err != nil || u.Scheme != "https" {
+			return ErrBadClientMetadata
+		}
+	}
+	switch md.DeliveryMode {
+	case "", DeliveryPoll:
+	case DeliveryPing, DeliveryPush:
+		if u, err := url.Parse(md.NotificationEndpoint); err != nil || u.Scheme != "https" {
+			return ErrBadClientMetadata
+		}
+	default:
+		return ErrBadClientMetadata
+	}
+	for _, t := range md.DetailTypes {
+		if _, found := p.AuthorizationDetailTypes[t]; !found {
+			return ErrBadClientMetadata
+		}
+	}
+	if md.JWKS != nil {
+		for _, k := range md.JWKS.Keys {
+			if _, err := k.PublicKey(); err != nil {
+				return ErrBadClientMetadata
+			}
+		}
+	}
+
+	c.DisplayName = md.ClientName
+	c.GrantTypes = grantTypes
+	c.ResponseTypes = responseTypes
+	c.ApplicationType = appType
+	c.RedirectURIs = rus
+	c.Scope = scope
+	c.JWKS = md.JWKS
+	c.RequireDPoP = md.DPoPBoundAccessTokens
+	c.TLSSubjectDN = md.TLSSubjectDN
+	c.TLSSANDNS = md.TLSSANDNS
+	c.RequirePushedRequests = md.RequirePushedRequests
+	c.RequireSignedRequests = md.RequireSignedRequests
+	c.RequestURIs = md.RequestURIs
+	c.AuthorizationDetailTypes = md.DetailTypes
+	c.BackchannelDeliveryMode = md.DeliveryMode
+	c.BackchannelNotificationEndpoint = md.NotificationEndpoint
+	c.TokenEndpointAuthMethod = method
+
+	// clients registered with the none method are public clients without a
+	// secret while other clients receive a secret if they do not have one
+	c.Type = ConfidentialClient
+	if method == None {
+		c.Type = PublicClient
+		c.Secret = ""
+	} else if c.Secret == "" {
+		c.Secret = newClientSecret()
+	}
+	return nil
+}
+
+func handleRegister(ctx *context) error {
+	p := ctx.provider
+	if p.Registrar == nil {
+		ctx.abort(http.StatusNotFound, "Not found")
+		return nil
+	}
+	if ctx.request.Method != "POST" {
+		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+
+	ok, err := p.Registrar.AuthorizeRegistration(ctx.bearerToken())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		ctx.json(http.StatusUnauthorized, ErrBadAccessToken)
+		return nil
+	}
+
+	md := &clientMetadata{}
+	if err := json.NewDecoder(ctx.request.Body).Decode(md); err != nil {
+		ctx.json(http.StatusBadRequest, ErrBadClientMetadata)
+		return nil
+	}
+
+	c := NewClient("", AuthorizationCode)
+	c.Status = ClientActive
+	c.Created = ctx.timestamp
+	if e := applyMetadata(p, c, md); e != nil {
+		ctx.json(http.StatusBadRequest, e)
+		return nil
+	}
+
+	token := randID()
+	c.RegistrationHash = hashRegistrationToken(token)
+	if err := p.Store.CreateClient(c); err != nil {
+		return err
+	}
+
+	ctx.json(http.StatusCreated, &registrationResponse{
+		c.ID,
+		c.Secret,
+		c.Created.Unix(),
+		0,
+		token,
+		p.endpoint("/register/" + c.ID),
+		metadataForClient(c),
+	})
+	return nil
+}
+
+// handleClientConfiguration implements the client configuration endpoint of
+// rfc7592 which reads, updates and deletes a registered client
+func handleClientConfiguration(ctx *context) error {
+	p := ctx.provider
+	if p.Registrar == nil {
+		ctx.abort(http.StatusNotFound, "Not found")
+		return nil
+	}
+
+	cid := ctx.request.URL.Path[strings.LastIndex(ctx.request.URL.Path, "/")+1:]
+	c, err := p.Store.FetchClient(cid)
+	if err != nil {
+		return err
+	}
+	hash := hashRegistrationToken(ctx.bearerToken())
+	if c == nil || c.RegistrationHash == "" ||
+		subtle.ConstantTimeCompare([]byte(hash), []byte(c.RegistrationHash)) != 1 {
+		ctx.json(http.StatusUnauthorized, ErrBadAccessToken)
+		return nil
+	}
+
+	token := ""
+	switch ctx.request.Method {
+	case "GET":
+	case "PUT":
+		cu := p.clientUpdater()
+		if cu == nil {
+			ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+			return nil
+		}
+		md := &registrationResponse{}
+		if err := json.NewDecoder(ctx.request.Body).Decode(md); err != nil || md.ClientID != c.ID {
+			ctx.json(http.StatusBadRequest, ErrBadClientMetadata)
+			return nil
+		}
+		if md.ClientSecret != "" && subtle.ConstantTimeCompare([]byte(md.ClientSecret), []byte(c.Secret)) != 1 {
+			ctx.json(http.StatusBadRequest, ErrBadClientMetadata)
+			return nil
+		}
+		// the stored client is left alone until the update is known to be
+		// valid and a new registration access token replaces the one that was
+		// used (rfc7592 section 2.2)
+		updated := *c
+		c = &updated
+		if e := applyMetadata(p, c, &md.clientMetadata); e != nil {
+			ctx.json(http.StatusBadRequest, e)
+			return nil
+		}
+		token = randID()
+		c.RegistrationHash = hashRegistrationToken(token)
+		if err := cu.UpdateClient(c); err != nil {
+			return err
+		}
+	case "DELETE":
+		if err := p.Store.DeleteClient(c.ID); err != nil {
+			return err
+		}
+		ctx.writer.WriteHeader(http.StatusNoContent)
+		return nil
+	default:
+		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+
+	ctx.json(http.StatusOK, &registrationResponse{
+		c.ID,
+		c.Secret,
+		c.Created.Unix(),
+		0,
+		token,
+		p.endpoint("/register/" + c.ID),
+		metadataForClient(c),
+	})
+	return nil
+}
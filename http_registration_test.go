@@ -0,0 +1,204 @@
+package ohauth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestRegistration(t *testing.T) {
+	p := *testProvider
+	p.Registrar = NewRegistrar([]string{"initial-token"}, nil)
+	h := p.Handler()
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "https://authz.example.com"+path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	md := `{
+		"client_name": "Partner App",
+		"redirect_uris": ["https://partner.example.com/cb"],
+		"grant_types": ["authorization_code", "refresh_token"],
+		"scope": "email"
+	}`
+	if w := do("POST", "/register", "", md); w.Code != http.StatusUnauthorized {
+		t.Fatalf("registration without initial access token: EXPECTED = %d - GOT = %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := do("POST", "/register", "initial-token", `{"grant_types": ["password"], "response_types": ["code"]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("registration with bad metadata: EXPECTED = %d - GOT = %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := do("POST", "/register", "initial-token", md)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("EXPECTED = %d - GOT = %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	res := &registrationResponse{}
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Store.FetchClient(res.ClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == nil || !c.AllowsGrant(AuthorizationCode) || !c.AllowsGrant(RefreshToken) || !c.AllowsResponseType("code") || c.Secret != res.ClientSecret || c.DisplayName != "Partner App" {
+		t.Fatalf("client was not registered correctly: %+v", c)
+	}
+
+	path := "/register/" + res.ClientID
+	token := res.RegistrationAccessToken
+	if w := do("GET", path, "initial-token", ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("read with wrong token: EXPECTED = %d - GOT = %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := do("GET", path, token, ""); w.Code != http.StatusOK {
+		t.Fatalf("read: EXPECTED = %d - GOT = %d", http.StatusOK, w.Code)
+	}
+
+	update := `{
+		"client_id": "` + res.ClientID + `",
+		"client_name": "Partner App v2",
+		"redirect_uris": ["https://partner.example.com/callback"],
+		"scope": "email"
+	}`
+	invalid := `{
+		"client_id": "` + res.ClientID + `",
+		"client_name": "Partner App v2",
+		"redirect_uris": ["https://partner.example.com/callback"],
+		"token_endpoint_auth_method": "unknown",
+		"scope": "email"
+	}`
+	if w := do("PUT", path, token, invalid); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid update: EXPECTED = %d - GOT = %d %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	c, err = p.Store.FetchClient(res.ClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DisplayName != "Partner App" {
+		t.Fatalf("client was changed by an invalid update: %+v", c)
+	}
+
+	w = do("PUT", path, token, update)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: EXPECTED = %d - GOT = %d %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	updated := &registrationResponse{}
+	if err := json.NewDecoder(w.Body).Decode(updated); err != nil {
+		t.Fatal(err)
+	}
+	c, err = p.Store.FetchClient(res.ClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DisplayName != "Partner App v2" || len(c.RedirectURIs) != 1 || c.RedirectURIs[0].String() != "https://partner.example.com/callback#_=_" {
+		t.Fatalf("client was not updated: %+v", c)
+	}
+	if updated.RegistrationAccessToken == "" || updated.RegistrationAccessToken == token {
+		t.Fatalf("registration access token was not rotated: %+v", updated)
+	}
+	if w := do("GET", path, token, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("read with replaced token: EXPECTED = %d - GOT = %d", http.StatusUnauthorized, w.Code)
+	}
+	token = updated.RegistrationAccessToken
+
+	if w := do("DELETE", path, token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: EXPECTED = %d - GOT = %d", http.StatusNoContent, w.Code)
+	}
+	if w := do("GET", path, token, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("read after delete: EXPECTED = %d - GOT = %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+type grantPolicy struct {
+	Registrar
+	grants []string
+}
+
+func (g *grantPolicy) RegistrationPermitted(grantTypes []string, scope Scope) bool {
+	for _, gt := range grantTypes {
+		if !containsString(g.grants, gt) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRegistration_restrictions(t *testing.T) {
+	key, _ := newAssertionKey(t)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	untrusted, _ := newAssertionKey(t)
+
+	p := *testProvider
+	p.Registrar = NewRegistrar(nil, map[string][]byte{"https://publisher.example.com": publisher})
+	p.ScopeRegistry = NewScopeRegistry(map[string]*ScopeDefinition{
+		"email": {},
+		"admin": {FirstParty: true},
+	})
+	register := func(body string) (int, map[string]interface{}) {
+		r := httptest.NewRequest("POST", "https://authz.example.com/register", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		p.Handler().ServeHTTP(w, r)
+		out := map[string]interface{}{}
+		if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, out
+	}
+
+	table := []struct {
+		name, body string
+	}{
+		{"password", `{"grant_types": ["password"], "scope": "email"}`},
+		{"client credentials", `{"grant_types": ["client_credentials"], "scope": "email"}`},
+		{"token exchange", `{"grant_types": ["urn:ietf:params:oauth:grant-type:token-exchange"], "scope": "email"}`},
+		{"first-party scope", `{"redirect_uris": ["https://partner.example.com/cb"], "scope": "admin"}`},
+		{"unregistered scope", `{"redirect_uris": ["https://partner.example.com/cb"], "scope": "orders"}`},
+	}
+	for _, r := range table {
+		if status, out := register(r.body); status != http.StatusBadRequest || out["error"] != InvalidClientMetadata {
+			t.Fatalf("%s: EXPECTED = %s - GOT = %d %v", r.name, InvalidClientMetadata, status, out)
+		}
+	}
+
+	p.Registrar = &grantPolicy{p.Registrar, []string{ClientCredentials}}
+	if status, out := register(`{"grant_types": ["client_credentials"], "scope": "email"}`); status != http.StatusCreated {
+		t.Fatalf("permitted by policy: EXPECTED = %d - GOT = %d %v", http.StatusCreated, status, out)
+	}
+	if status, out := register(`{"grant_types": ["password"], "scope": "email"}`); status != http.StatusBadRequest {
+		t.Fatalf("refused by policy: EXPECTED = %d - GOT = %d %v", http.StatusBadRequest, status, out)
+	}
+
+	claims := map[string]interface{}{
+		"iss":           "https://publisher.example.com",
+		"client_name":   "Published App",
+		"redirect_uris": []string{"https://publisher.example.com/cb"},
+		"grant_types":   []string{ClientCredentials},
+		"scope":         "email",
+	}
+	statement := signAssertion(t, jwt.SigningMethodES256, key, nil, claims)
+	status, out := register(`{"client_name": "Plain App", "software_statement": "` + statement + `"}`)
+	if status != http.StatusCreated || out["client_name"] != "Published App" {
+		t.Fatalf("software statement: EXPECTED = %d - GOT = %d %v", http.StatusCreated, status, out)
+	}
+	forged := signAssertion(t, jwt.SigningMethodES256, untrusted, nil, claims)
+	if status, out := register(`{"software_statement": "` + forged + `"}`); status != http.StatusBadRequest || out["error"] != UnapprovedSoftwareStatement {
+		t.Fatalf("forged software statement: EXPECTED = %s - GOT = %d %v", UnapprovedSoftwareStatement, status, out)
+	}
+}
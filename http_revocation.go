@@ -0,0 +1,82 @@
+package ohauth
+
+import "net/http"
+
+// tokenRevoked determines if a token was revoked on its own or along with the
+// grant it belongs to
+func (p *Provider) tokenRevoked(tc *TokenClaims) (bool, error) {
+	for _, id := range []string{tc.ID, tc.GrantID} {
+		if id == "" {
+			continue
+		}
+		bl, err := p.Store.TokenBlacklisted(id)
+		if err != nil || bl {
+			return bl, err
+		}
+	}
+	return false, nil
+}
+
+func handleRevoke(ctx *context) error {
+	p := ctx.provider
+	if ctx.request.Method != "POST" {
+		ctx.abort(http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+	if err := ctx.request.ParseForm(); err != nil {
+		return err
+	}
+
+	caller, err := ctx.authenticateClient()
+	if err != nil {
+		return err
+	}
+	if caller == nil {
+		ctx.failClientAuth()
+		return nil
+	}
+
+	raw := ctx.request.PostForm.Get("token")
+	if raw == "" {
+		ctx.json(http.StatusBadRequest, ErrMissingToken)
+		return nil
+	}
+
+	// tokens carry their own role so a token_type_hint is accepted but never
+	// needed to locate the token. Invalid tokens do not cause an error since the
+	// client cannot do anything more about them (rfc7009 section 2.2).
+	tc, _, err := ctx.parseToken(raw, caller)
+	if err != nil {
+		return err
+	}
+	if tc == nil {
+		ctx.writer.WriteHeader(http.StatusOK)
+		return nil
+	}
+	if tc.clientID() != caller.ID {
+		ctx.json(http.StatusBadRequest, ErrUnauthorized)
+		return nil
+	}
+
+	ids := []string{tc.ID}
+	switch tc.Role {
+	case RoleAccessToken:
+	case RoleRefreshToken:
+		// refresh tokens are linked to the access token they were issued with
+		// and revoking one revokes every token of its grant (rfc7009 section
+		// 2.1)
+		ids = append(ids, tc.Subject, tc.grantID())
+	default:
+		ctx.json(http.StatusBadRequest, ErrUnsupportedTokenType)
+		return nil
+	}
+
+	for _, id := range uniqueStrings(ids) {
+		if err := p.Store.BlacklistToken(id); err != nil {
+			return err
+		}
+	}
+
+	ctx.writer.WriteHeader(http.StatusOK)
+	return nil
+}
@@ -0,0 +1,183 @@
+package ohauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRevoke_refreshToken(t *testing.T) {
+	client := NewClient("Test Client", Password)
+	client.Scope = ParseScope("email")
+	client.Status = ClientActive
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	status, out := postGrant(t, url.Values{
+		"grant_type":    {Password},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"username":      {"testuser"},
+		"password":      {"testpassword"},
+		"scope":         {"email"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("password grant failed: %d %v", status, out)
+	}
+
+	form := url.Values{
+		"client_id":       {client.ID},
+		"client_secret":   {client.Secret},
+		"token":           {out["refresh_token"].(string)},
+		"token_type_hint": {"refresh_token"},
+	}
+	r, err := http.NewRequest("POST", "https://authz.example.com/revoke", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if err := handleRevoke(&context{testProvider, w, r, time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("EXPECTED = %d - GOT = %d", http.StatusOK, w.Code)
+	}
+
+	for _, tok := range []string{"access_token", "refresh_token"} {
+		tc, err := testProvider.Tokenizer.Parse(out[tok].(string), client.Keys.Verify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bl, err := testProvider.Store.TokenBlacklisted(tc.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bl {
+			t.Fatalf("%s was not revoked", tok)
+		}
+	}
+}
+
+func TestRevoke_refreshedTokens(t *testing.T) {
+	client := NewClient("Test Client", Password)
+	client.Scope = ParseScope("email")
+	client.Status = ClientActive
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	status, out := postGrant(t, url.Values{
+		"grant_type":    {Password},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"username":      {"testuser"},
+		"password":      {"testpassword"},
+		"scope":         {"email"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("password grant failed: %d %v", status, out)
+	}
+	rt := out["refresh_token"].(string)
+	status, refreshed := postGrant(t, url.Values{
+		"grant_type":    {RefreshToken},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"refresh_token": {rt},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("refresh grant failed: %d %v", status, refreshed)
+	}
+
+	form := url.Values{
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"token":         {rt},
+	}
+	r := httptest.NewRequest("POST", "https://authz.example.com/revoke", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if err := handleRevoke(&context{testProvider, w, r, time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("EXPECTED = %d - GOT = %d", http.StatusOK, w.Code)
+	}
+
+	for _, tok := range []string{out["access_token"].(string), refreshed["access_token"].(string)} {
+		r := httptest.NewRequest("POST", "https://authz.example.com/introspect", nil)
+		res, err := introspect(&context{testProvider, httptest.NewRecorder(), r, time.Now()}, tok, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Active {
+			t.Fatalf("EXPECTED access token of the revoked grant to be inactive - GOT = %+v", res)
+		}
+	}
+	if status, out := postGrant(t, url.Values{
+		"grant_type":    {RefreshToken},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"refresh_token": {rt},
+	}); status != http.StatusBadRequest {
+		t.Fatalf("EXPECTED revoked refresh token to be refused - GOT = %d %v", status, out)
+	}
+}
+
+func TestRevoke_accessTokenKeepsGrant(t *testing.T) {
+	client := NewClient("Test Client", Password)
+	client.Scope = ParseScope("email")
+	client.Status = ClientActive
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	status, out := postGrant(t, url.Values{
+		"grant_type":    {Password},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"username":      {"testuser"},
+		"password":      {"testpassword"},
+		"scope":         {"email"},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("password grant failed: %d %v", status, out)
+	}
+
+	form := url.Values{
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"token":         {out["access_token"].(string)},
+	}
+	r := httptest.NewRequest("POST", "https://authz.example.com/revoke", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if err := handleRevoke(&context{testProvider, w, r, time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("EXPECTED = %d - GOT = %d", http.StatusOK, w.Code)
+	}
+
+	status, refreshed := postGrant(t, url.Values{
+		"grant_type":    {RefreshToken},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"refresh_token": {out["refresh_token"].(string)},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("EXPECTED refresh token to outlive the revoked access token - GOT = %d %v", status, refreshed)
+	}
+	r = httptest.NewRequest("POST", "https://authz.example.com/introspect", nil)
+	res, err := introspect(&context{testProvider, httptest.NewRecorder(), r, time.Now()}, refreshed["access_token"].(string), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Active {
+		t.Fatalf("EXPECTED refreshed access token to be active - GOT = %+v", res)
+	}
+}
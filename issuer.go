@@ -8,13 +8,76 @@ type Issuer interface {
 	// specified grant type
 	ExpiryForToken(grantType string) time.Duration
 	// ExpiryForCode returns the expiry duration for codes issued with the
-	// Authorization Code grant type
+	// Authorization Code and Device Authorization grant types
 	ExpiryForCode() time.Duration
 	// ScopePermitted determines if a scope can be issued under a certain grant
 	// type
 	ScopePermitted(scope Scope, grantType string) bool
 }
 
+// ExchangePolicy may be implemented by an Issuer to permit token exchange
+// beyond the client's own tokens. Without it a client may only exchange tokens
+// issued to or addressed to itself for a token addressed to itself. With it the
+// policy also decides on subject tokens addressed to registered resources and
+// on tokens for other audiences.
+type ExchangePolicy interface {
+	// ExchangePermitted determines if a client may exchange a subject token,
+	// optionally presented together with an actor token, for a token with the
+	// specified audience and scope
+	ExchangePermitted(client *Client, subject, actor *TokenClaims, audience string, scope Scope) bool
+}
+
+// IntrospectionPolicy may be implemented by an Issuer to let resource servers
+// introspect access tokens. Without it a client may only introspect tokens
+// issued to it or addressed to it.
+type IntrospectionPolicy interface {
+	// ResourceServer determines if a client is a resource server that may
+	// introspect access tokens issued to other clients
+	ResourceServer(client *Client) bool
+}
+
+// PublicClientPolicy may be implemented by an Issuer to issue different tokens
+// to public clients. Without it public clients receive tokens with the same
+// lifetimes as confidential clients and their refresh tokens are rotated.
+type PublicClientPolicy interface {
+	// ExpiryForPublicToken returns the expiry duration for tokens issued to
+	// public clients under a specified grant type
+	ExpiryForPublicToken(grantType string) time.Duration
+	// RotateRefreshToken determines if a refresh token is replaced by a new one
+	// each time the client uses it
+	RotateRefreshToken(client *Client) bool
+}
+
+func (p *Provider) expiryForToken(c *Client, grantType string) time.Duration {
+	if policy, ok := p.Issuer.(PublicClientPolicy); ok && c.IsPublic() {
+		return policy.ExpiryForPublicToken(grantType)
+	}
+	return p.Issuer.ExpiryForToken(grantType)
+}
+
+// introspectionPermitted determines if a client may learn about a token. Refresh
+// tokens are only described to the client they were issued to.
+func (p *Provider) introspectionPermitted(caller *Client, tc *TokenClaims) bool {
+	if caller.ID == tc.clientID() {
+		return true
+	}
+	if tc.Role != RoleAccessToken {
+		return false
+	}
+	if tc.Audience == caller.ID {
+		return true
+	}
+	policy, ok := p.Issuer.(IntrospectionPolicy)
+	return ok && policy.ResourceServer(caller)
+}
+
+func (p *Provider) rotateRefreshToken(c *Client) bool {
+	if policy, ok := p.Issuer.(PublicClientPolicy); ok {
+		return policy.RotateRefreshToken(c)
+	}
+	return c.IsPublic()
+}
+
 type defaultIssuer struct{}
 
 func (d *defaultIssuer) ExpiryForCode() time.Duration {
@@ -32,6 +95,19 @@ func (d *defaultIssuer) ExpiryForToken(grantType string) time.Duration {
 	}
 }
 
+func (d *defaultIssuer) ExpiryForPublicToken(grantType string) time.Duration {
+	switch grantType {
+	case RefreshToken:
+		return 7 * 24 * time.Hour
+	default:
+		return time.Hour
+	}
+}
+
+func (d *defaultIssuer) RotateRefreshToken(client *Client) bool {
+	return client.IsPublic()
+}
+
 func (*defaultIssuer) ScopePermitted(Scope, string) bool {
 	return true
 }
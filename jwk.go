@@ -0,0 +1,160 @@
+package ohauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+// ErrUnsupportedKey is returned when a key cannot be represented as or
+// converted from a JSON Web Key
+var ErrUnsupportedKey = errors.New("unsupported key type")
+
+// JWK is a JSON Web Key (rfc7517) holding an RSA or elliptic curve public key
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Modulus   string `json:"n,omitempty"`
+	Exponent  string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is a set of JSON Web Keys such as the jwks client metadata value
+type JWKSet struct {
+	Keys []*JWK `json:"keys"`
+}
+
+var b64 = base64.RawURLEncoding
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// NewJWK creates a JWK from an RSA or ECDSA public key. The key id is set to the
+// key's rfc7638 thumbprint.
+func NewJWK(pub crypto.PublicKey) (*JWK, error) {
+	k := &JWK{}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		k.KeyType = "RSA"
+		k.Modulus = b64.EncodeToString(pub.N.Bytes())
+		k.Exponent = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		k.KeyType = "EC"
+		k.Curve = pub.Curve.Params().Name
+		k.X = b64.EncodeToString(pad(pub.X.Bytes(), size))
+		k.Y = b64.EncodeToString(pad(pub.Y.Bytes(), size))
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	k.KeyID = k.Thumbprint()
+	return k, nil
+}
+
+func pad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// PublicKey converts the JWK into an *rsa.PublicKey or *ecdsa.PublicKey
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := b64.DecodeString(k.Modulus)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64.DecodeString(k.Exponent)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		curve, found := curves[k.Curve]
+		if !found {
+			return nil, ErrUnsupportedKey
+		}
+		x, err := b64.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, ErrUnsupportedKey
+		}
+		return pub, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// Thumbprint computes the rfc7638 SHA-256 thumbprint of the key
+func (k *JWK) Thumbprint() string {
+	members := map[string]string{"kty": k.KeyType}
+	switch k.KeyType {
+	case "RSA":
+		members["n"] = k.Modulus
+		members["e"] = k.Exponent
+	case "EC":
+		members["crv"] = k.Curve
+		members["x"] = k.X
+		members["y"] = k.Y
+	}
+	// encoding/json sorts map keys which gives the required lexicographic order
+	b, err := json.Marshal(members)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return b64.EncodeToString(sum[:])
+}
+
+// Find returns the key with the specified key id. If kid is empty and the set
+// holds a single key then that key is returned.
+func (s *JWKSet) Find(kid string) *JWK {
+	if s == nil {
+		return nil
+	}
+	if kid == "" && len(s.Keys) == 1 {
+		return s.Keys[0]
+	}
+	for _, k := range s.Keys {
+		if k.KeyID == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+// parsePublicKeyPEM decodes a PEM encoded PKIX public key such as the verify key
+// in ClientKeys
+func parsePublicKeyPEM(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
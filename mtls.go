@@ -0,0 +1,122 @@
+package ohauth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+)
+
+// Client authentication methods using TLS client certificates (rfc8705
+// section 2)
+const (
+	TLSClientAuth           = "tls_client_auth"
+	SelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+)
+
+// CertificateThumbprint computes the x5t#S256 value of a certificate, the
+// base64url encoded SHA-256 hash of its DER encoding
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return b64.EncodeToString(sum[:])
+}
+
+// clientCertificates returns the certificate chain presented by the client
+// with the leaf certificate first. The chain is read from the TLS connection
+// or, if the provider is configured with one, from the header set by a trusted
+// proxy. Nil is returned if there is no certificate.
+func (c *context) clientCertificates() []*x509.Certificate {
+	r := c.request
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates
+	}
+	if c.provider.CertificateHeader == "" {
+		return nil
+	}
+	raw, err := url.QueryUnescape(r.Header.Get(c.provider.CertificateHeader))
+	if err != nil {
+		return nil
+	}
+	certs := []*x509.Certificate{}
+	rest := []byte(raw)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil
+	}
+	return certs
+}
+
+// authenticateWithCertificate verifies the client certificate sent with a
+// request. With tls_client_auth the certificate must chain to one of the
+// provider's ClientCAs and match the client's registered subject. With
+// self_signed_tls_client_auth its public key must be one of the client's
+// registered keys.
+func authenticateWithCertificate(ctx *context, c *Client, cc *clientCredentials) (bool, error) {
+	certs := ctx.clientCertificates()
+	if len(certs) == 0 {
+		return false, nil
+	}
+	leaf := certs[0]
+
+	if cc.method == SelfSignedTLSClientAuth {
+		k, err := NewJWK(leaf.PublicKey)
+		if err != nil || c.JWKS == nil {
+			return false, nil
+		}
+		for _, registered := range c.JWKS.Keys {
+			if registered.Thumbprint() == k.Thumbprint() {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if ctx.provider.ClientCAs == nil {
+		return false, nil
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         ctx.provider.ClientCAs,
+		Intermediates: intermediates,
+		CurrentTime:   ctx.timestamp,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return false, nil
+	}
+	switch {
+	case c.TLSSubjectDN != "":
+		return leaf.Subject.String() == c.TLSSubjectDN, nil
+	case c.TLSSANDNS != "":
+		return containsString(leaf.DNSNames, c.TLSSANDNS), nil
+	}
+	return false, nil
+}
+
+// VerifyCertificateBinding determines if an access token bound to a client
+// certificate was sent by a resource server's client over a TLS connection
+// using that certificate (rfc8705 section 3)
+func VerifyCertificateBinding(r *http.Request, tc *TokenClaims) bool {
+	if tc == nil || tc.Confirmation == nil || tc.Confirmation.X509Thumbprint == "" {
+		return false
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false
+	}
+	return CertificateThumbprint(r.TLS.PeerCertificates[0]) == tc.Confirmation.X509Thumbprint
+}
@@ -0,0 +1,152 @@
+package ohauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCertificate creates a client certificate for a common name signed by a
+// parent certificate or self-signed if parent is nil
+func newCertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, ca bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestGrant_mutualTLS(t *testing.T) {
+	ca, caKey := newCertificate(t, "Internal CA", nil, nil, true)
+	cert, certKey := newCertificate(t, "orders-service", ca, caKey, false)
+	selfSigned, selfSignedKey := newCertificate(t, "billing-service", nil, nil, false)
+
+	p := *testProvider
+	p.ClientCAs = x509.NewCertPool()
+	p.ClientCAs.AddCert(ca)
+	p.CertificateHeader = "X-Client-Cert"
+
+	orders := NewClient("Orders Service", ClientCredentials)
+	orders.TokenEndpointAuthMethod = TLSClientAuth
+	orders.TLSSubjectDN = "CN=orders-service"
+	other := NewClient("Other Service", ClientCredentials)
+	other.TokenEndpointAuthMethod = TLSClientAuth
+	other.TLSSANDNS = "other.example.com"
+	k, err := NewJWK(&selfSignedKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	billing := NewClient("Billing Service", ClientCredentials)
+	billing.TokenEndpointAuthMethod = SelfSignedTLSClientAuth
+	billing.JWKS = &JWKSet{Keys: []*JWK{k}}
+	for _, c := range []*Client{orders, other, billing} {
+		c.Status = ClientActive
+		if err := p.Store.CreateClient(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := httptest.NewUnstartedServer(p.Handler())
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	table := []struct {
+		name   string
+		client *Client
+		cert   *x509.Certificate
+		key    *ecdsa.PrivateKey
+		status int
+	}{
+		{"ca issued", orders, cert, certKey, http.StatusOK},
+		{"other subject", other, cert, certKey, http.StatusUnauthorized},
+		{"self-signed", billing, selfSigned, selfSignedKey, http.StatusOK},
+		{"self-signed for ca client", orders, selfSigned, selfSignedKey, http.StatusUnauthorized},
+		{"no certificate", orders, nil, nil, http.StatusUnauthorized},
+	}
+	for _, r := range table {
+		// each case needs its own connection to present a different certificate
+		tr := srv.Client().Transport.(*http.Transport).Clone()
+		if r.cert != nil {
+			tr.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{r.cert.Raw}, PrivateKey: r.key}}
+		}
+		hc := &http.Client{Transport: tr}
+		res, err := hc.PostForm(srv.URL+"/token", url.Values{"grant_type": {ClientCredentials}, "client_id": {r.client.ID}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]interface{}{}
+		err = json.NewDecoder(res.Body).Decode(&out)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != r.status {
+			t.Fatalf("%s: EXPECTED = %d - GOT = %d %v", r.name, r.status, res.StatusCode, out)
+		}
+		if r.status != http.StatusOK {
+			continue
+		}
+		at, err := p.Tokenizer.Parse(out["access_token"].(string), r.client.Keys.Verify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at.Confirmation == nil || at.Confirmation.X509Thumbprint != CertificateThumbprint(r.cert) {
+			t.Fatalf("%s: access token was not bound to the certificate: %+v", r.name, at.Confirmation)
+		}
+		req := httptest.NewRequest("GET", "https://api.example.com/orders", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{r.cert}}
+		if !VerifyCertificateBinding(req, at) {
+			t.Fatalf("%s: certificate binding was not verified", r.name)
+		}
+		req.TLS.PeerCertificates = []*x509.Certificate{ca}
+		if VerifyCertificateBinding(req, at) {
+			t.Fatalf("%s: certificate binding verified with another certificate", r.name)
+		}
+	}
+
+	form := url.Values{"grant_type": {ClientCredentials}, "client_id": {orders.ID}}
+	req := httptest.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Client-Cert", url.QueryEscape(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))))
+	w := httptest.NewRecorder()
+	if err := handleGrant(&context{&p, w, req, time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("proxy header: EXPECTED = %d - GOT = %d %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
@@ -1,12 +1,18 @@
 package ohauth
 
 import (
+	"crypto/x509"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+// ErrNoProviderKeys is returned when the provider needs to sign a document
+// such as an ID token without having Keys
+var ErrNoProviderKeys = errors.New("provider has no keys")
+
 var issuer = &defaultIssuer{}
 var tokenizer = NewJWTTokenizer(jwt.SigningMethodRS256)
 
@@ -23,39 +29,105 @@ type Provider struct {
 	Tokenizer Tokenizer
 	// Issuer is used to determine claim values when issuing tokens
 	Issuer Issuer
+	// Registrar enables dynamic client registration when it is set
+	Registrar Registrar
+	// TrustedIssuers maps the issuers of JWT bearer assertions that may be
+	// exchanged for access tokens on behalf of any subject to their keys
+	TrustedIssuers map[string]*JWKSet
+	// Keys are the provider's own keys used to sign documents that are not
+	// bound to a single client such as ID tokens and introspection responses.
+	// DPoP nonces and backchannel authentication are not supported without
+	// them.
+	Keys *ClientKeys
+	// ClientCAs verifies the certificates of clients using the tls_client_auth
+	// authentication method
+	ClientCAs *x509.CertPool
+	// CertificateHeader names a header in which a trusted proxy that terminates
+	// TLS forwards the url encoded PEM client certificate. The proxy must remove
+	// the header from the requests it receives.
+	CertificateHeader string
+	// EncryptionKeys decrypt request objects that clients encrypt with the
+	// public key. Encrypted request objects are not supported without them.
+	EncryptionKeys *ClientKeys
+	// HTTPClient fetches request objects passed by reference and notifies
+	// clients of completed backchannel authentication requests. A client with
+	// a timeout is used if it is nil. Redirects are never followed when a
+	// request object is fetched.
+	HTTPClient *http.Client
+	// AuthorizationDetailTypes registers the types of authorization details
+	// (rfc9396) clients may request with a validator for each. Details of a
+	// type with a nil validator are accepted as they are.
+	AuthorizationDetailTypes map[string]AuthorizationDetailValidator
+	// Resources maps the uris of the protected resources that access tokens
+	// may be issued for (rfc8707) to the scope each of them accepts
+	Resources map[string]Scope
+	// Approver enables client initiated backchannel authentication when it is
+	// set by asking resource owners to approve requests on their own devices
+	Approver BackchannelApprover
+	// ScopeHierarchy makes actions grant those below them and the actions
+	// its rules imply. Actions are compared exactly when it is nil.
+	ScopeHierarchy *ScopeHierarchy
+	// ScopeRegistry describes the actions clients may request and restricts
+	// who they are issued to. Any action is permitted when it is nil.
+	ScopeRegistry *ScopeRegistry
 }
 
 // NewProvider creates a provider configured with the default tokenizer and
-// issuer.
+// issuer and a freshly generated set of provider keys.
 func NewProvider(u *StrictURL, authn Authenticator, store Store) *Provider {
 	return &Provider{
-		u,
-		authn,
-		store,
-		tokenizer,
-		issuer,
+		URL:           u,
+		Authenticator: authn,
+		Store:         store,
+		Tokenizer:     tokenizer,
+		Issuer:        issuer,
+		Keys:          NewClientKeys(),
 	}
 }
 
-// Handler returns an http.Handler that can be integrated into web applications
-func (p *Provider) Handler() http.Handler {
-	mux := http.NewServeMux()
-	mux.HandleFunc(p.URL.Path+"/authorize", func(w http.ResponseWriter, r *http.Request) {
-		defer func() { _ = r.Body.Close() }()
-		if err := handleAuthorize(&context{p, w, r, time.Now()}); err != nil {
-			panic(err)
-		}
-	})
-	mux.HandleFunc(p.URL.Path+"/token", func(w http.ResponseWriter, r *http.Request) {
+// endpoints maps the paths served by a provider, relative to its URL, to the
+// functions that handle them
+var endpoints = map[string]func(*context) error{
+	"/authorize":                        handleAuthorize,
+	"/token":                            handleGrant,
+	"/introspect":                       handleIntrospect,
+	"/revoke":                           handleRevoke,
+	"/par":                              handlePushedRequest,
+	"/device_authorization":             handleDeviceAuthorization,
+	"/device":                           handleDevice,
+	"/bc-authorize":                     handleBackchannelAuthentication,
+	"/jwks":                             handleJWKS,
+	"/register":                         handleRegister,
+	"/register/":                        handleClientConfiguration,
+	"/.well-known/openid-configuration": handleMetadata,
+	"/.well-known/oauth-authorization-server": handleMetadata,
+}
+
+func (p *Provider) handle(h func(*context) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() { _ = r.Body.Close() }()
-		if err := handleGrant(&context{p, w, r, time.Now()}); err != nil {
+		if err := h(&context{p, w, r, time.Now()}); err != nil {
 			panic(err)
 		}
-	})
+	}
+}
+
+// Handler returns an http.Handler that can be integrated into web applications
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for path, h := range endpoints {
+		mux.HandleFunc(p.URL.Path+path, p.handle(h))
+	}
+	// rfc8414 inserts the well-known path between the host and the issuer path
+	if p.URL.Path != "" && p.URL.Path != "/" {
+		mux.HandleFunc("/.well-known/oauth-authorization-server"+p.URL.Path, p.handle(handleMetadata))
+	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "POST" {
+		switch r.Method {
+		case "GET", "POST", "PUT", "DELETE":
 			mux.ServeHTTP(w, r)
+			return
 		}
 
 		w.WriteHeader(http.StatusMethodNotAllowed)
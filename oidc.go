@@ -0,0 +1,47 @@
+package ohauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// OpenID is the scope value that turns an OAuth 2.0 authorization request into
+// an OpenID Connect authentication request
+const OpenID = "openid"
+
+// tokenHash computes the at_hash and c_hash values defined in OpenID Connect
+// Core section 3.3.2.11. The default tokenizer signs with RS256 so the left-most
+// half of a SHA-256 hash is used.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// newIDToken creates the claims of an ID token for the resource owner that
+// approved an authorization code or another grant. The access token and code,
+// if any, are bound to the ID token through their hashes.
+func newIDToken(ctx *context, c *Client, code *TokenClaims, at, rawCode string) *TokenClaims {
+	p := ctx.provider
+	idt := NewTokenClaims(RoleIdentity, ctx.timestamp, ctx.timestamp.Add(p.expiryForToken(c, code.Grant)))
+	idt.ID = randID()
+	idt.Audience = c.ID
+	idt.AuthorizedParty = c.ID
+	idt.Subject = code.Subject
+	idt.Issuer = p.issuer()
+	idt.Grant = code.Grant
+	idt.Nonce = code.Nonce
+	idt.AuthTime = code.AuthTime
+	idt.AccessTokenHash = tokenHash(at)
+	if rawCode != "" {
+		idt.CodeHash = tokenHash(rawCode)
+	}
+	return idt
+}
+
+// signIDToken signs an ID token with the provider keys
+func (p *Provider) signIDToken(idt *TokenClaims) (string, error) {
+	if p.Keys == nil {
+		return "", ErrNoProviderKeys
+	}
+	return p.Tokenizer.Tokenize(idt, p.Keys.Sign)
+}
@@ -0,0 +1,85 @@
+package ohauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrant_codeWithIDToken(t *testing.T) {
+	client := NewClient("Test Client", AuthorizationCode)
+	client.Scope = ParseScope("openid,email")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://example.com/cb")}
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	authTime := time.Now().Add(-5 * time.Minute)
+	session := &TokenClaims{Subject: "testuser", Issued: authTime.Unix()}
+	code := issueCode(t, &authorizationRequest{
+		client, session, client.RedirectURIs[0], true, client.Scope, "state", true, "", "", "n-0S6_WzA2Mj", nil, nil, nil,
+	})
+	status, out := postGrant(t, url.Values{
+		"grant_type":    {AuthorizationCode},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"redirect_uri":  {client.RedirectURIs[0].String()},
+		"code":          {code},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("code grant failed: %d %v", status, out)
+	}
+
+	idt, err := testProvider.Tokenizer.Parse(out["id_token"].(string), testProvider.Keys.Verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idt.Issuer != "https://authz.example.com" {
+		t.Fatalf("EXPECTED = https://authz.example.com - GOT = %s", idt.Issuer)
+	}
+	if idt.Nonce != "n-0S6_WzA2Mj" || idt.AuthTime != authTime.Unix() || idt.Subject != "testuser" {
+		t.Fatalf("unexpected id token claims: %+v", idt)
+	}
+	if idt.AuthorizedParty != client.ID || idt.AccessTokenHash != tokenHash(out["access_token"].(string)) {
+		t.Fatalf("id token is not bound to the client and access token: %+v", idt)
+	}
+	if idt.CodeHash != tokenHash(code) {
+		t.Fatalf("id token is not bound to the code: %+v", idt)
+	}
+}
+
+func TestGrant_idTokenWithoutKeys(t *testing.T) {
+	p := *testProvider
+	p.Keys = nil
+
+	client := NewClient("Test Client", AuthorizationCode)
+	client.Scope = ParseScope("openid,email")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://example.com/cb")}
+	if err := p.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	code := issueCode(t, &authorizationRequest{
+		client, &TokenClaims{Subject: "testuser"}, client.RedirectURIs[0], true, client.Scope, "state", true, "", "", "", nil, nil, nil,
+	})
+	form := url.Values{
+		"grant_type":    {AuthorizationCode},
+		"client_id":     {client.ID},
+		"client_secret": {client.Secret},
+		"redirect_uri":  {client.RedirectURIs[0].String()},
+		"code":          {code},
+	}
+	r := httptest.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if err := handleGrant(&context{&p, w, r, time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), ServerError) {
+		t.Fatalf("EXPECTED = %d %s - GOT = %d %s", http.StatusInternalServerError, ServerError, w.Code, w.Body.String())
+	}
+}
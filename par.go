@@ -0,0 +1,36 @@
+package ohauth
+
+import (
+	"net/url"
+	"time"
+)
+
+// RequestURIPrefix starts every request_uri created for a pushed authorization
+// request (rfc9126 section 2.2)
+const RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// pushed authorization requests must be used soon after they are created but
+// they must also last while the resource owner is prompted for approval
+const pushedRequestExpiry = 5 * time.Minute
+
+// PushedRequest holds the parameters of an authorization request that a client
+// pushed to the provider (rfc9126) until it is referenced by its request_uri
+type PushedRequest struct {
+	RequestURI string     `json:"requestURI"`
+	CID        string     `json:"cid"`
+	Params     url.Values `json:"params"`
+	Expires    time.Time  `json:"expires"`
+	Created    time.Time  `json:"created"`
+}
+
+// NewPushedRequest creates a pushed authorization request with a random
+// request_uri
+func NewPushedRequest(cid string, params url.Values, iat, exp time.Time) *PushedRequest {
+	return &PushedRequest{
+		RequestURI: RequestURIPrefix + randToken(),
+		CID:        cid,
+		Params:     params,
+		Expires:    exp,
+		Created:    iat,
+	}
+}
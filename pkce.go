@@ -0,0 +1,44 @@
+package ohauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// Code challenge methods defined in rfc7636
+const (
+	PKCEPlain = "plain"
+	PKCES256  = "S256"
+)
+
+// code challenges and verifiers share the same grammar in rfc7636 section 4.1
+var pkceRE = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// validChallenge checks that a code challenge and its method are acceptable for
+// recording in an authorization code
+func validChallenge(challenge, method string) bool {
+	if method != PKCEPlain && method != PKCES256 {
+		return false
+	}
+	return pkceRE.MatchString(challenge)
+}
+
+// verifyChallenge checks a code verifier presented at the token endpoint
+// against the challenge recorded when the code was issued
+func verifyChallenge(challenge, method, verifier string) bool {
+	if !pkceRE.MatchString(verifier) {
+		return false
+	}
+	computed := verifier
+	switch method {
+	case PKCEPlain:
+	case PKCES256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
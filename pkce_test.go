@@ -0,0 +1,91 @@
+package ohauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestVerifyChallenge(t *testing.T) {
+	// example values from rfc7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	table := []struct {
+		challenge, method, verifier string
+		expected                    bool
+	}{
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", PKCES256, verifier, true},
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", PKCES256, verifier + "x", false},
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", PKCEPlain, verifier, false},
+		{verifier, PKCEPlain, verifier, true},
+		{verifier, "S512", verifier, false},
+		{"short", PKCEPlain, "short", false},
+	}
+	for _, r := range table {
+		if res := verifyChallenge(r.challenge, r.method, r.verifier); res != r.expected {
+			t.Fatalf("verifyChallenge(%s, %s, %s): EXPECTED = %t - GOT = %t", r.challenge, r.method, r.verifier, r.expected, res)
+		}
+	}
+}
+
+// issueCode runs an approved authorization request for a client and returns
+// the code it was redirected with
+func issueCode(t *testing.T, req *authorizationRequest) string {
+	r, err := http.NewRequest("POST", "https://authz.example.com/authorize", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	if err := authorizeWithCode(&context{testProvider, w, r, time.Now()}, req); err != nil {
+		t.Fatal(err)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := loc.Query().Get("error"); e != "" {
+		t.Fatalf("authorization failed: %s", e)
+	}
+	return loc.Query().Get("code")
+}
+
+func TestGrant_codeWithPKCE(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	client := NewClient("Test Client", AuthorizationCode)
+	client.Scope = ParseScope("openid,email")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://example.com/cb")}
+	client.RequirePKCE = true
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	session := &TokenClaims{Subject: "testuser"}
+	table := []struct {
+		verifier string
+		status   int
+	}{
+		{verifier, http.StatusOK},
+		{"", http.StatusBadRequest},
+		{verifier[1:] + "x", http.StatusBadRequest},
+	}
+	for _, r := range table {
+		code := issueCode(t, &authorizationRequest{
+			client, session, client.RedirectURIs[0], true, client.Scope, "state", true, challenge, PKCES256, "", nil, nil, nil,
+		})
+		status, out := postGrant(t, url.Values{
+			"grant_type":    {AuthorizationCode},
+			"client_id":     {client.ID},
+			"client_secret": {client.Secret},
+			"redirect_uri":  {client.RedirectURIs[0].String()},
+			"code":          {code},
+			"code_verifier": {r.verifier},
+		})
+		if status != r.status {
+			t.Fatalf("verifier %q: EXPECTED = %d - GOT = %d %v", r.verifier, r.status, status, out)
+		}
+	}
+}
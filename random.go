@@ -2,6 +2,7 @@ package ohauth
 
 import (
 	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 )
 
@@ -18,3 +19,7 @@ func randID() string {
 	b := randBytes(16)
 	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
+
+func randToken() string {
+	return base64.RawURLEncoding.EncodeToString(randBytes(32))
+}
@@ -0,0 +1,190 @@
+package ohauth
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// possible values for Client.RedirectMatching
+const (
+	// RedirectExact only accepts a redirect uri identical to a registered one
+	RedirectExact = "exact"
+	// RedirectLoopback also accepts any port on a registered loopback
+	// ip literal as described in rfc8252 section 7.3
+	RedirectLoopback = "loopback"
+	// RedirectPrefix also accepts paths below a registered path on the
+	// same host. It exists for legacy clients and should be avoided.
+	RedirectPrefix = "prefix"
+)
+
+// ErrBadNativeRedirect is returned when a redirect uri cannot be used by a
+// native application
+var ErrBadNativeRedirect = errors.New("native redirect uris must use a loopback ip, private-use scheme or https")
+
+// RedirectPolicy parses a redirect uri that a type of client may register and
+// use. It returns an error for uris the policy does not allow.
+type RedirectPolicy func(raw string) (*StrictURL, error)
+
+// redirect policies for each client application type. Web clients keep the
+// strict https uris created by ParseURL.
+var redirectPolicies = map[string]RedirectPolicy{
+	WebApplication:    ParseURL,
+	NativeApplication: ParseNativeURL,
+}
+
+// ParseNativeURL parses the redirect uris that native applications may use
+// according to rfc8252 section 7. These are http uris on a loopback ip literal,
+// private-use uri schemes in reverse domain name notation and claimed https
+// uris.
+func ParseNativeURL(raw string) (*StrictURL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case u.Scheme == "https":
+		return ParseURL(raw)
+	case u.Scheme == "http":
+		ip := net.ParseIP(u.Hostname())
+		if ip == nil || !ip.IsLoopback() || u.User != nil {
+			return nil, ErrBadNativeRedirect
+		}
+	case strings.Contains(u.Scheme, "."):
+		if u.Opaque != "" || u.User != nil {
+			return nil, ErrBadNativeRedirect
+		}
+	default:
+		return nil, ErrBadNativeRedirect
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return (*StrictURL)(u), nil
+}
+
+// RedirectPolicy returns the policy for the client's application type or nil
+// if the application type is unknown
+func (c *Client) RedirectPolicy() RedirectPolicy {
+	t := c.ApplicationType
+	if t == "" {
+		t = WebApplication
+	}
+	return redirectPolicies[t]
+}
+
+var redirectMatchers = map[string]func(registered, requested *url.URL) bool{
+	RedirectExact:    matchRedirectExact,
+	RedirectLoopback: matchRedirectLoopback,
+	RedirectPrefix:   matchRedirectPrefix,
+}
+
+func matchRedirectExact(registered, requested *url.URL) bool {
+	return registered.String() == requested.String()
+}
+
+func matchRedirectLoopback(registered, requested *url.URL) bool {
+	ip := net.ParseIP(registered.Hostname())
+	if ip == nil || !ip.IsLoopback() {
+		return false
+	}
+	return registered.Scheme == requested.Scheme &&
+		registered.User == nil && requested.User == nil &&
+		registered.Hostname() == requested.Hostname() &&
+		registered.Path == requested.Path
+}
+
+func matchRedirectPrefix(registered, requested *url.URL) bool {
+	if registered.Scheme != requested.Scheme || registered.Host != requested.Host ||
+		registered.User != nil || requested.User != nil {
+		return false
+	}
+	// escaped separators and dot segments could otherwise climb out of the
+	// registered path
+	if requested.RawPath != "" || requested.Path != cleanPath(requested.Path) {
+		return false
+	}
+	base := registered.Path
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return requested.Path == registered.Path || strings.HasPrefix(requested.Path, base)
+}
+
+// cleanPath is path.Clean except that it keeps a trailing slash
+func cleanPath(p string) string {
+	if p == "" {
+		return p
+	}
+	c := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && c != "/" {
+		c += "/"
+	}
+	return c
+}
+
+// MatchRedirectURI finds the redirect uri to use for an authorization request.
+// An empty raw uri is only allowed when the client has registered exactly one
+// redirect uri (rfc6749 section 3.1.2.3). Native applications may always use
+// any port on a registered loopback uri. Nil is returned if raw is not allowed
+// by the client's RedirectPolicy or does not match any registered redirect uri.
+func (c *Client) MatchRedirectURI(raw string) *StrictURL {
+	if raw == "" {
+		if len(c.RedirectURIs) != 1 || c.RedirectURIs[0] == nil {
+			return nil
+		}
+		return c.RedirectURIs[0].Clone()
+	}
+
+	parse := c.RedirectPolicy()
+	if parse == nil {
+		return nil
+	}
+	ru, err := parse(raw)
+	if err != nil {
+		return nil
+	}
+	method := c.RedirectMatching
+	if method == "" {
+		method = RedirectExact
+	}
+	match, found := redirectMatchers[method]
+	if !found {
+		return nil
+	}
+	for _, u := range c.RedirectURIs {
+		if u == nil {
+			continue
+		}
+		registered, err := parse(u.String())
+		if err != nil {
+			continue
+		}
+		r1, r2 := (*url.URL)(registered), (*url.URL)(ru)
+		if matchRedirectExact(r1, r2) || match(r1, r2) ||
+			c.ApplicationType == NativeApplication && matchRedirectLoopback(r1, r2) {
+			return ru
+		}
+	}
+	return nil
+}
+
+// redeemRedirect determines if the redirect uri sent with a token request is
+// the one an authorization code was delivered to (rfc6749 section 4.1.3). It
+// may only be left out if the authorization request left it out as well.
+func redeemRedirect(c *Client, code *TokenClaims, raw string) bool {
+	if raw == "" {
+		if code.RedirectURISent {
+			return false
+		}
+		ru := c.MatchRedirectURI("")
+		return ru != nil && ru.String() == code.RedirectURI
+	}
+	parse := c.RedirectPolicy()
+	if parse == nil {
+		return false
+	}
+	ru, err := parse(raw)
+	return err == nil && ru.String() == code.RedirectURI
+}
@@ -0,0 +1,157 @@
+package ohauth
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestMatchRedirectURI(t *testing.T) {
+	table := []struct {
+		matching   string
+		registered []string
+		raw        string
+		expected   string
+	}{
+		{"", []string{"https://example.com/cb"}, "", "https://example.com/cb#_=_"},
+		{"", []string{"https://example.com/cb", "https://example.com/other"}, "", ""},
+		{"", []string{"https://example.com/cb", "https://example.com/other"}, "https://example.com/other", "https://example.com/other#_=_"},
+		{"", []string{"https://example.com/cb"}, "https://example.com/cb/nested", ""},
+		{RedirectLoopback, []string{"https://127.0.0.1/cb"}, "https://127.0.0.1:53211/cb", "https://127.0.0.1:53211/cb#_=_"},
+		{RedirectLoopback, []string{"https://127.0.0.1/cb"}, "https://127.0.0.1:53211/other", ""},
+		{RedirectLoopback, []string{"https://localhost/cb"}, "https://localhost:53211/cb", ""},
+		{RedirectLoopback, []string{"https://example.com/cb"}, "https://example.com:8443/cb", ""},
+		{RedirectPrefix, []string{"https://example.com/partner"}, "https://example.com/partner/cb", "https://example.com/partner/cb#_=_"},
+		{RedirectPrefix, []string{"https://example.com/partner"}, "https://example.com/partnerx/cb", ""},
+		{RedirectPrefix, []string{"https://example.com/partner"}, "https://example.com/partner/../admin", ""},
+		{RedirectPrefix, []string{"https://example.com/partner"}, "https://example.com/partner/..%2fadmin", ""},
+		{RedirectPrefix, []string{"https://example.com/partner"}, "https://example.com:8443/partner/cb", ""},
+		{"glob", []string{"https://example.com/cb"}, "https://example.com/cb", ""},
+	}
+	for _, r := range table {
+		c := &Client{RedirectMatching: r.matching}
+		for _, raw := range r.registered {
+			c.RedirectURIs = append(c.RedirectURIs, MustParseURL(raw))
+		}
+		if res := c.MatchRedirectURI(r.raw).String(); res != r.expected {
+			t.Fatalf("%s %v %q: EXPECTED = %q - GOT = %q", r.matching, r.registered, r.raw, r.expected, res)
+		}
+	}
+}
+
+func TestParseNativeURL(t *testing.T) {
+	table := []struct {
+		raw      string
+		expected string
+	}{
+		{"http://127.0.0.1:53211/callback", "http://127.0.0.1:53211/callback"},
+		{"http://[::1]/callback?x=1", "http://[::1]/callback"},
+		{"http://localhost:53211/callback", ""},
+		{"http://app.example.com/callback", ""},
+		{"com.example.app:/oauth2redirect", "com.example.app:/oauth2redirect"},
+		{"com.example.app:oauth2redirect", ""},
+		{"myapp:/oauth2redirect", ""},
+		{"javascript:alert(1)", ""},
+		{"https://app.example.com/callback", "https://app.example.com/callback#_=_"},
+	}
+	for _, r := range table {
+		u, err := ParseNativeURL(r.raw)
+		if r.expected == "" && err == nil {
+			t.Fatalf("%s: EXPECTED error - GOT = %s", r.raw, u)
+		}
+		if r.expected != "" && (err != nil || u.String() != r.expected) {
+			t.Fatalf("%s: EXPECTED = %s - GOT = %s %v", r.raw, r.expected, u, err)
+		}
+	}
+
+	web := &Client{RedirectURIs: []*StrictURL{MustParseURL("https://app.example.com/cb")}}
+	native := &Client{ApplicationType: NativeApplication}
+	for _, raw := range []string{"http://127.0.0.1/callback", "com.example.app:/oauth2redirect"} {
+		u, err := ParseNativeURL(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		native.RedirectURIs = append(native.RedirectURIs, u)
+	}
+	if u := native.MatchRedirectURI("http://127.0.0.1:53211/callback"); u.String() != "http://127.0.0.1:53211/callback" {
+		t.Fatalf("native loopback redirect: GOT = %s", u)
+	}
+	if u := native.MatchRedirectURI("com.example.app:/oauth2redirect"); u == nil {
+		t.Fatal("native private-use redirect was not matched")
+	}
+	if u := web.MatchRedirectURI("http://127.0.0.1:53211/callback"); u != nil {
+		t.Fatalf("web client matched loopback redirect: %s", u)
+	}
+}
+
+func TestGrant_codeRedirectURI(t *testing.T) {
+	client := NewClient("Test Client", AuthorizationCode)
+	client.Scope = ParseScope("email")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://example.com/cb"), MustParseURL("https://example.com/other")}
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	session := &TokenClaims{Subject: "testuser"}
+	table := []struct {
+		redirect string
+		status   int
+	}{
+		{"", http.StatusBadRequest},
+		{"https://example.com/cb", http.StatusBadRequest},
+		{"https://example.com/other", http.StatusOK},
+	}
+	for _, r := range table {
+		code := issueCode(t, &authorizationRequest{
+			client, session, client.RedirectURIs[1], true, client.Scope, "state", true, "", "", "", nil, nil, nil,
+		})
+		status, out := postGrant(t, url.Values{
+			"grant_type":    {AuthorizationCode},
+			"client_id":     {client.ID},
+			"client_secret": {client.Secret},
+			"redirect_uri":  {r.redirect},
+			"code":          {code},
+		})
+		if status != r.status {
+			t.Fatalf("redirect %q: EXPECTED = %d - GOT = %d %v", r.redirect, r.status, status, out)
+		}
+	}
+}
+
+func TestGrant_codeRedirectURISent(t *testing.T) {
+	client := NewClient("Test Client", AuthorizationCode)
+	client.Scope = ParseScope("email")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://example.com/cb")}
+	if err := testProvider.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	session := &TokenClaims{Subject: "testuser"}
+	table := []struct {
+		sent     bool
+		redirect string
+		status   int
+	}{
+		{true, "", http.StatusBadRequest},
+		{true, "https://example.com/cb", http.StatusOK},
+		{false, "", http.StatusOK},
+		{false, "https://example.com/cb", http.StatusOK},
+	}
+	for _, r := range table {
+		code := issueCode(t, &authorizationRequest{
+			client, session, client.RedirectURIs[0], r.sent, client.Scope, "state", true, "", "", "", nil, nil, nil,
+		})
+		status, out := postGrant(t, url.Values{
+			"grant_type":    {AuthorizationCode},
+			"client_id":     {client.ID},
+			"client_secret": {client.Secret},
+			"redirect_uri":  {r.redirect},
+			"code":          {code},
+		})
+		if status != r.status {
+			t.Fatalf("sent %t, redirect %q: EXPECTED = %d - GOT = %d %v", r.sent, r.redirect, r.status, status, out)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package ohauth
+
+import (
+	"crypto/subtle"
+	"fmt"
+)
+
+// Registrar controls dynamic client registration (rfc7591). Registration is
+// disabled for providers that are not configured with a Registrar.
+type Registrar interface {
+	// AuthorizeRegistration checks the initial access token sent as a bearer
+	// token with a registration request. The token is empty if none was sent.
+	AuthorizeRegistration(initialAccessToken string) (bool, error)
+	// VerifySoftwareStatement verifies a software statement and returns the
+	// client metadata values it asserts
+	VerifySoftwareStatement(statement string) (map[string]interface{}, error)
+}
+
+// RegistrationPolicy may be implemented by a Registrar to decide which grant
+// types and scope registered clients may use. Without it registered clients
+// are limited to the grant types in which a resource owner approves the client
+// and to a scope that the provider permits under each of them.
+type RegistrationPolicy interface {
+	// RegistrationPermitted determines if a client registering itself may use
+	// the specified grant types and scope
+	RegistrationPermitted(grantTypes []string, scope Scope) bool
+}
+
+// registrationGrants are the grant types a client may register for without a
+// RegistrationPolicy. Grant types that issue tokens without the approval of a
+// resource owner, or with their credentials, are left out.
+var registrationGrants = map[string]bool{
+	AuthorizationCode: true,
+	Implicit:          true,
+	RefreshToken:      true,
+	DeviceCode:        true,
+	CIBA:              true,
+}
+
+// registrationPermitted determines if a registering client may use the
+// specified grant types and scope
+func (p *Provider) registrationPermitted(c *Client, grantTypes []string, scope Scope) bool {
+	if policy, ok := p.Registrar.(RegistrationPolicy); ok {
+		if !policy.RegistrationPermitted(grantTypes, scope) {
+			return false
+		}
+	} else {
+		for _, gt := range grantTypes {
+			if !registrationGrants[gt] {
+				return false
+			}
+		}
+	}
+	for _, gt := range grantTypes {
+		if !p.scopePermitted(c, scope, gt) {
+			return false
+		}
+	}
+	return true
+}
+
+type defaultRegistrar struct {
+	tokens     []string
+	publishers map[string][]byte
+}
+
+// NewRegistrar creates a Registrar that only accepts registration requests
+// carrying one of the listed initial access tokens, or any request if the list
+// is empty. Software statements are accepted if they are signed by one of the
+// publishers, which maps an issuer to its PEM encoded public key.
+func NewRegistrar(initialAccessTokens []string, publishers map[string][]byte) Registrar {
+	return &defaultRegistrar{initialAccessTokens, publishers}
+}
+
+func (r *defaultRegistrar) AuthorizeRegistration(token string) (bool, error) {
+	if len(r.tokens) == 0 {
+		return true, nil
+	}
+	for _, t := range r.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *defaultRegistrar) VerifySoftwareStatement(statement string) (map[string]interface{}, error) {
+	return parseSignedClaims(statement, func(header, claims map[string]interface{}) (interface{}, error) {
+		iss, _ := claims["iss"].(string)
+		key, found := r.publishers[iss]
+		if !found {
+			return nil, fmt.Errorf("untrusted software statement issuer: %s", iss)
+		}
+		return parsePublicKeyPEM(key)
+	})
+}
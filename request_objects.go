@@ -0,0 +1,246 @@
+package ohauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestObjectAlgs lists the JWS algorithms accepted for request objects.
+// Request objects must be signed with one of the client's registered keys.
+var requestObjectAlgs = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512"}
+
+// key management algorithms and content encryption algorithms accepted for
+// encrypted request objects
+var (
+	requestObjectEncAlgs = map[string]func() hash.Hash{
+		"RSA-OAEP":     sha1.New,
+		"RSA-OAEP-256": sha256.New,
+	}
+	requestObjectEncs = map[string]int{
+		"A128GCM": 16,
+		"A192GCM": 24,
+		"A256GCM": 32,
+	}
+)
+
+// request objects fetched by reference are limited in size and time
+const (
+	requestObjectMaxSize = 64 * 1024
+	requestObjectTimeout = 10 * time.Second
+)
+
+// JWT claims in a request object that are not authorization request parameters
+var requestObjectClaims = []string{"iss", "aud", "exp", "iat", "nbf", "jti"}
+
+// decryptJWE decrypts a JWE in compact serialization (rfc7516) that was
+// encrypted to an RSA key using one of the supported algorithms
+func decryptJWE(raw string, key *rsa.PrivateKey) ([]byte, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 5 {
+		return nil, errors.New("JWE contains an invalid number of segments")
+	}
+	header, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	h, found := requestObjectEncAlgs[claimString(header, "alg")]
+	size, found2 := requestObjectEncs[claimString(header, "enc")]
+	if !found || !found2 || header["zip"] != nil {
+		return nil, fmt.Errorf("unsupported JWE algorithm: %v %v", header["alg"], header["enc"])
+	}
+
+	segs := make([][]byte, 4)
+	for i := range segs {
+		if segs[i], err = b64.DecodeString(parts[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	cek, err := rsa.DecryptOAEP(h(), nil, key, segs[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(cek) != size {
+		return nil, errors.New("JWE content encryption key has the wrong size")
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(segs[1]) != gcm.NonceSize() {
+		return nil, errors.New("JWE initialization vector has the wrong size")
+	}
+	// the protected header is the additional authenticated data
+	return gcm.Open(nil, segs[1], append(segs[2], segs[3]...), []byte(parts[0]))
+}
+
+// parsePrivateKeyPEM parses the PKCS1 RSA private key of a ClientKeys instance
+func parsePrivateKeyPEM(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// fetchRequestObject retrieves a request object from one of the urls
+// registered by the client
+func (p *Provider) fetchRequestObject(c *Client, uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "https" {
+		return "", fmt.Errorf("request uri must use https")
+	}
+	registered := false
+	for _, r := range c.RequestURIs {
+		ru, err := url.Parse(r)
+		if err == nil && ru.Scheme == u.Scheme && ru.Host == u.Host && ru.Path == u.Path && ru.RawQuery == u.RawQuery {
+			registered = true
+		}
+	}
+	if !registered {
+		return "", fmt.Errorf("request uri is not registered")
+	}
+
+	// redirects are never followed, not even by a configured client, since
+	// they could lead to a url the client did not register
+	hc := http.Client{Timeout: requestObjectTimeout}
+	if p.HTTPClient != nil {
+		hc = *p.HTTPClient
+	}
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := hc.Get(uri)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request uri responded with %d", res.StatusCode)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, requestObjectMaxSize))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// verifyRequestObject decrypts, if necessary, and verifies a request object
+// (rfc9101) and returns the authorization request parameters it holds. The
+// object must be signed with one of the client's registered keys, must be
+// addressed to the provider and must not have expired (rfc9101 section 10.8).
+// Any iss claim must identify the client. A request object with a jti may only
+// be used for a single authorization response, which is recorded once the
+// response is issued. Nil parameters are returned if the request object is
+// invalid.
+func verifyRequestObject(ctx *context, c *Client, raw string) (url.Values, *oneTimeUse) {
+	p := ctx.provider
+	if strings.Count(raw, ".") == 4 {
+		if p.EncryptionKeys == nil {
+			return nil, nil
+		}
+		key, err := parsePrivateKeyPEM(p.EncryptionKeys.Sign)
+		if err != nil {
+			return nil, nil
+		}
+		b, err := decryptJWE(raw, key)
+		if err != nil {
+			return nil, nil
+		}
+		raw = string(b)
+	}
+
+	claims, err := parseSignedClaims(raw, func(header, claims map[string]interface{}) (interface{}, error) {
+		if !containsString(requestObjectAlgs, claimString(header, "alg")) {
+			return nil, ErrUnsupportedKey
+		}
+		return jwksKey(c.JWKS, claimString(header, "kid"))
+	})
+	if err != nil {
+		return nil, nil
+	}
+	if claimString(claims, "client_id") != c.ID {
+		return nil, nil
+	}
+	if iss, ok := claims["iss"]; ok && iss != c.ID {
+		return nil, nil
+	}
+	if !claimAudience(claims, p.issuer(), p.URL.String()) {
+		return nil, nil
+	}
+	exp, ok := claimTime(claims, "exp")
+	if !ok || !exp.After(ctx.timestamp) {
+		return nil, nil
+	}
+	var use *oneTimeUse
+	if jti := claimString(claims, "jti"); jti != "" {
+		use = &oneTimeUse{"request:" + c.ID + ":" + jti, exp, ErrBadRequestObject}
+	}
+
+	params := url.Values{}
+	for name, v := range claims {
+		if containsString(requestObjectClaims, name) {
+			continue
+		}
+		switch value := v.(type) {
+		case string:
+			params.Set(name, value)
+		case float64:
+			params.Set(name, strconv.FormatFloat(value, 'f', -1, 64))
+		case bool:
+			params.Set(name, strconv.FormatBool(value))
+		default:
+			// structured parameters such as claims are passed on as JSON
+			b, err := json.Marshal(value)
+			if err != nil {
+				return nil, nil
+			}
+			params.Set(name, string(b))
+		}
+	}
+	return params, use
+}
+
+// requestObject resolves the request object sent in the request parameter or
+// referenced by a request_uri. Nil parameters are returned if the client is
+// unknown or the request object cannot be retrieved or verified.
+func (c *context) requestObject(q url.Values) (url.Values, *oneTimeUse, error) {
+	p := c.provider
+	client, err := p.Store.FetchClient(q.Get("client_id"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if client == nil || client.Status != ClientActive {
+		return nil, nil, nil
+	}
+	raw := q.Get("request")
+	if uri := q.Get("request_uri"); uri != "" {
+		if raw != "" {
+			return nil, nil, nil
+		}
+		if raw, err = p.fetchRequestObject(client, uri); err != nil {
+			return nil, nil, nil
+		}
+	}
+	params, use := verifyRequestObject(c, client, raw)
+	return params, use, nil
+}
@@ -0,0 +1,185 @@
+package ohauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// encryptJWE encrypts a payload to an RSA key with RSA-OAEP-256 and A256GCM
+func encryptJWE(t *testing.T, key *rsa.PublicKey, payload string) string {
+	header := b64.EncodeToString([]byte(`{"alg":"RSA-OAEP-256","enc":"A256GCM"}`))
+	cek := make([]byte, 32)
+	iv := make([]byte, 12)
+	if _, err := rand.Read(cek); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatal(err)
+	}
+	ek, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, cek, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := gcm.Seal(nil, iv, []byte(payload), []byte(header))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return strings.Join([]string{
+		header,
+		b64.EncodeToString(ek),
+		b64.EncodeToString(iv),
+		b64.EncodeToString(ciphertext),
+		b64.EncodeToString(tag),
+	}, ".")
+}
+
+func TestAuthorize_requestObject(t *testing.T) {
+	p := *testProvider
+	p.Authenticator = &subjectAuthenticator{testProvider.Authenticator, "jaruser"}
+	p.EncryptionKeys = NewClientKeys()
+
+	key, k := newAssertionKey(t)
+	other, _ := newAssertionKey(t)
+	client := NewClient("Test Client", AuthorizationCode)
+	client.Scope = ParseScope("email,profile")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://example.com/cb")}
+	client.JWKS = &JWKSet{Keys: []*JWK{k}}
+	client.RequireSignedRequests = true
+	if err := p.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	signClaims := func(key interface{}, claims map[string]interface{}) string {
+		base := map[string]interface{}{
+			"iss":           client.ID,
+			"aud":           p.URL.String(),
+			"exp":           time.Now().Add(time.Minute).Unix(),
+			"client_id":     client.ID,
+			"response_type": "code",
+			"redirect_uri":  "https://example.com/cb",
+			"scope":         "email",
+			"state":         "signed",
+		}
+		for k, v := range claims {
+			if v == nil {
+				delete(base, k)
+			} else {
+				base[k] = v
+			}
+		}
+		return signAssertion(t, jwt.SigningMethodES256, key, nil, base)
+	}
+	sign := func(key interface{}) string {
+		return signClaims(key, nil)
+	}
+	authorize := func(params url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "https://authz.example.com/authorize", strings.NewReader(params.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := handleAuthorize(&context{&p, w, r, time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	expectCode := func(name string, w *httptest.ResponseRecorder) {
+		loc, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := p.Tokenizer.Parse(loc.Query().Get("code"), client.Keys.Verify)
+		if err != nil {
+			t.Fatalf("%s: EXPECTED code - GOT = %d %s", name, w.Code, loc)
+		}
+		if !code.Scope.Equals(ParseScope("email")) || loc.Query().Get("state") != "signed" {
+			t.Fatalf("%s: code was not issued for the request object: %s %v", name, loc, code.Scope)
+		}
+	}
+
+	// loose parameters are ignored in favour of the signed ones
+	expectCode("signed", authorize(url.Values{
+		"client_id": {client.ID},
+		"request":   {sign(key)},
+		"scope":     {"email,profile"},
+	}))
+
+	pub, err := parsePublicKeyPEM(p.EncryptionKeys.Verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCode("encrypted", authorize(url.Values{
+		"client_id": {client.ID},
+		"request":   {encryptJWE(t, pub.(*rsa.PublicKey), sign(key))},
+	}))
+
+	if w := authorize(url.Values{"client_id": {client.ID}, "request": {sign(other)}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("wrong key: EXPECTED = %d - GOT = %d", http.StatusBadRequest, w.Code)
+	}
+	for name, claims := range map[string]map[string]interface{}{
+		"without aud":  {"aud": nil},
+		"other aud":    {"aud": "https://other.example.com"},
+		"without exp":  {"exp": nil},
+		"expired":      {"exp": time.Now().Add(-time.Minute).Unix()},
+		"other client": {"iss": "someone-else"},
+	} {
+		if w := authorize(url.Values{"client_id": {client.ID}, "request": {signClaims(key, claims)}}); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: EXPECTED = %d - GOT = %d %s", name, http.StatusBadRequest, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// a request object with a jti is only good for a single response
+	once := signClaims(key, map[string]interface{}{"jti": randID()})
+	expectCode("jti", authorize(url.Values{"client_id": {client.ID}, "request": {once}}))
+	w := authorize(url.Values{"client_id": {client.ID}, "request": {once}})
+	if loc := w.Header().Get("Location"); !strings.Contains(loc, "error="+InvalidRequestObject) {
+		t.Fatalf("replayed request object: EXPECTED = %s - GOT = %d %s", InvalidRequestObject, w.Code, loc)
+	}
+	w = authorize(url.Values{
+		"client_id":     {client.ID},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://example.com/cb"},
+		"scope":         {"email"},
+	})
+	if loc := w.Header().Get("Location"); !strings.Contains(loc, "error="+InvalidRequest) {
+		t.Fatalf("EXPECTED signed request to be required - GOT = %s", loc)
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved.jwt" {
+			http.Redirect(w, r, "/request.jwt", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/oauth-authz-req+jwt")
+		_, _ = w.Write([]byte(sign(key)))
+	}))
+	defer srv.Close()
+	p.HTTPClient = srv.Client()
+	if w := authorize(url.Values{"client_id": {client.ID}, "request_uri": {srv.URL + "/request.jwt"}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("unregistered request uri: EXPECTED = %d - GOT = %d", http.StatusBadRequest, w.Code)
+	}
+	client.RequestURIs = []string{srv.URL + "/request.jwt", srv.URL + "/moved.jwt"}
+	if err := p.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	expectCode("by reference", authorize(url.Values{"client_id": {client.ID}, "request_uri": {srv.URL + "/request.jwt"}}))
+	if w := authorize(url.Values{"client_id": {client.ID}, "request_uri": {srv.URL + "/moved.jwt"}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("redirected request uri: EXPECTED = %d - GOT = %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package ohauth
+
+import "net/url"
+
+// requestedResources parses the resource parameters of a request. Each must be
+// an absolute uri without a fragment that identifies a protected resource
+// registered with the provider (rfc8707 section 2). False is returned if any of
+// them is not valid.
+func (p *Provider) requestedResources(q url.Values) ([]string, bool) {
+	for _, r := range q["resource"] {
+		u, err := url.Parse(r)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return nil, false
+		}
+		if _, found := p.Resources[r]; !found {
+			return nil, false
+		}
+	}
+	return uniqueStrings(q["resource"]), true
+}
+
+// restrictToResource sets the audience of an access token to the resource it
+// is issued for and narrows its scope to the actions that resource accepts.
+// The resource must be one of those granted, if the grant was limited to some,
+// and a token may only be issued for a single resource. Tokens requested
+// without a resource are issued for the client itself.
+func (p *Provider) restrictToResource(at *TokenClaims, c *Client, granted, requested []string) *Error {
+	at.ClientID = c.ID
+	at.Audience = c.ID
+	requested = uniqueStrings(requested)
+	if len(requested) == 0 {
+		requested = granted
+	}
+	if len(requested) == 0 {
+		return nil
+	}
+	if len(requested) > 1 {
+		return ErrAmbiguousResource
+	}
+
+	r := requested[0]
+	allowed, found := p.Resources[r]
+	if !found || len(granted) > 0 && !containsString(granted, r) {
+		return ErrBadResource
+	}
+	scope := Scope{}
+	for action := range at.Scope {
+		if p.ScopeHierarchy.Grants(allowed, action) {
+			scope[action] = true
+		}
+	}
+	if len(scope) == 0 && len(at.Scope) > 0 {
+		return ErrScopeNotAllowed
+	}
+	at.Audience = r
+	at.Scope = scope
+	return nil
+}
@@ -0,0 +1,126 @@
+package ohauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrant_resourceIndicators(t *testing.T) {
+	orders := "https://api.example.com/orders"
+	billing := "https://api.example.com/billing"
+	p := *testProvider
+	p.Authenticator = &subjectAuthenticator{testProvider.Authenticator, "resourceuser"}
+	p.Resources = map[string]Scope{
+		orders:  ParseScope("orders"),
+		billing: ParseScope("billing"),
+	}
+
+	client := NewClient("Test Client", AuthorizationCode, RefreshToken)
+	client.Scope = ParseScope("orders,billing,email")
+	client.Status = ClientActive
+	client.RedirectURIs = []*StrictURL{MustParseURL("https://example.com/cb")}
+	if err := p.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	authorize := func(resources ...string) *url.URL {
+		form := url.Values{
+			"client_id":     {client.ID},
+			"response_type": {"code"},
+			"redirect_uri":  {"https://example.com/cb"},
+			"scope":         {"orders,billing"},
+			"resource":      resources,
+		}
+		r := httptest.NewRequest("POST", "https://authz.example.com/authorize", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := handleAuthorize(&context{&p, w, r, time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		loc, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return loc
+	}
+	grant := func(form url.Values) (int, map[string]interface{}) {
+		form.Set("client_id", client.ID)
+		form.Set("client_secret", client.Secret)
+		r := httptest.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := handleGrant(&context{&p, w, r, time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]interface{}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, out
+	}
+	expectToken := func(name string, status int, out map[string]interface{}, aud string, scope Scope) {
+		if status != http.StatusOK {
+			t.Fatalf("%s: EXPECTED = %d - GOT = %d %v", name, http.StatusOK, status, out)
+		}
+		at, err := p.Tokenizer.Parse(out["access_token"].(string), client.Keys.Verify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if at.Audience != aud || at.ClientID != client.ID || !at.Scope.Equals(scope) {
+			t.Fatalf("%s: EXPECTED aud = %s scope = %s - GOT = %s %s", name, aud, scope, at.Audience, at.Scope)
+		}
+		r := httptest.NewRequest("POST", "https://authz.example.com/introspect", nil)
+		res, err := introspect(&context{&p, httptest.NewRecorder(), r, time.Now()}, out["access_token"].(string), client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Active || res.Audience != aud || res.ClientID != client.ID {
+			t.Fatalf("%s: introspection did not describe the token: %+v", name, res)
+		}
+	}
+
+	for _, r := range []string{"https://api.example.com/unknown", "/orders", orders + "#fragment"} {
+		if loc := authorize(r); loc.Query().Get("error") != InvalidTarget {
+			t.Fatalf("%s: EXPECTED = %s - GOT = %s", r, InvalidTarget, loc)
+		}
+	}
+
+	code := authorize(orders, billing).Query().Get("code")
+	form := url.Values{
+		"grant_type":   {AuthorizationCode},
+		"code":         {code},
+		"redirect_uri": {"https://example.com/cb"},
+	}
+	if status, out := grant(form); status != http.StatusBadRequest || out["error"] != InvalidTarget {
+		t.Fatalf("no resource for a grant of two: EXPECTED = %s - GOT = %d %v", InvalidTarget, status, out)
+	}
+	form.Set("resource", orders)
+	status, out := grant(form)
+	expectToken("code", status, out, orders, ParseScope("orders"))
+
+	rt := out["refresh_token"].(string)
+	status, out = grant(url.Values{"grant_type": {RefreshToken}, "refresh_token": {rt}, "resource": {billing}})
+	expectToken("refresh", status, out, billing, ParseScope("billing"))
+
+	status, out = grant(url.Values{"grant_type": {RefreshToken}, "refresh_token": {rt}, "resource": {"https://api.example.com/unknown"}})
+	if status != http.StatusBadRequest || out["error"] != InvalidTarget {
+		t.Fatalf("unregistered resource: EXPECTED = %s - GOT = %d %v", InvalidTarget, status, out)
+	}
+
+	code = authorize(orders).Query().Get("code")
+	status, out = grant(url.Values{
+		"grant_type":   {AuthorizationCode},
+		"code":         {code},
+		"redirect_uri": {"https://example.com/cb"},
+	})
+	expectToken("single resource", status, out, orders, ParseScope("orders"))
+	status, out = grant(url.Values{"grant_type": {RefreshToken}, "refresh_token": {out["refresh_token"].(string)}, "resource": {billing}})
+	if status != http.StatusBadRequest || out["error"] != InvalidTarget {
+		t.Fatalf("resource outside the grant: EXPECTED = %s - GOT = %d %v", InvalidTarget, status, out)
+	}
+}
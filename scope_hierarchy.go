@@ -0,0 +1,103 @@
+package ohauth
+
+import "strings"
+
+// default separator between the levels of hierarchical actions
+const scopeSeparator = ":"
+
+// actions ending with the wildcard grant every action below them
+const scopeWildcard = "*"
+
+// ScopeHierarchy is an opt-in scope model in which granting an action also
+// grants the actions below it, so that "orders" grants "orders:read" and
+// "orders:write:refund". An action ending with a wildcard, such as "admin:*",
+// grants every action below its parent and "*" grants every action. Further
+// implications that the hierarchy cannot express are listed as explicit
+// rules. A nil hierarchy compares actions exactly.
+type ScopeHierarchy struct {
+	// Separator delimits the levels of an action
+	Separator string
+	// Implies maps actions to the others they grant. Rules apply
+	// transitively.
+	Implies map[string]Scope
+}
+
+// NewScopeHierarchy creates a scope hierarchy whose levels are separated by
+// colons with the specified implication rules
+func NewScopeHierarchy(implies map[string]Scope) *ScopeHierarchy {
+	return &ScopeHierarchy{scopeSeparator, implies}
+}
+
+// expand returns a scope with every action implied by its rules added
+func (h *ScopeHierarchy) expand(s Scope) Scope {
+	out := Scope{}
+	queue := s.Values()
+	for len(queue) > 0 {
+		action := queue[0]
+		queue = queue[1:]
+		if out[action] {
+			continue
+		}
+		out[action] = true
+		queue = append(queue, h.Implies[action].Values()...)
+	}
+	return out
+}
+
+// grantedBy determines if an action is granted by a single action of an
+// expanded scope
+func (h *ScopeHierarchy) grantedBy(granted, action string) bool {
+	if granted == action {
+		return true
+	}
+	if granted == scopeWildcard {
+		return true
+	}
+	if strings.HasSuffix(granted, h.Separator+scopeWildcard) {
+		parent := strings.TrimSuffix(granted, scopeWildcard)
+		return len(action) > len(parent) && strings.HasPrefix(action, parent)
+	}
+	return strings.HasPrefix(action, granted+h.Separator)
+}
+
+func (h *ScopeHierarchy) grants(expanded Scope, action string) bool {
+	if expanded[action] {
+		return true
+	}
+	for g := range expanded {
+		if h.grantedBy(g, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// Grants determines if a scope grants an action
+func (h *ScopeHierarchy) Grants(s Scope, action string) bool {
+	if h == nil {
+		return s[action]
+	}
+	return h.grants(h.expand(s), action)
+}
+
+// Contains determines if a scope grants every action of another
+func (h *ScopeHierarchy) Contains(s, s2 Scope) bool {
+	if h == nil {
+		return s.Contains(s2)
+	}
+	expanded := h.expand(s)
+	for action := range s2 {
+		if !h.grants(expanded, action) {
+			return false
+		}
+	}
+	return true
+}
+
+// Equals determines if two scopes grant the same actions
+func (h *ScopeHierarchy) Equals(s, s2 Scope) bool {
+	if h == nil {
+		return s.Equals(s2)
+	}
+	return h.Contains(s, s2) && h.Contains(s2, s)
+}
@@ -0,0 +1,83 @@
+package ohauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScopeHierarchyContains(t *testing.T) {
+	h := NewScopeHierarchy(map[string]Scope{
+		"admin":  ParseScope("orders billing"),
+		"orders": ParseScope("reports:orders"),
+	})
+	table := []struct {
+		granted, requested string
+		expected           bool
+	}{
+		{"orders", "orders:read orders:write:refund", true},
+		{"orders:read", "orders", false},
+		{"orders", "ordersx", false},
+		{"admin:*", "admin:users admin:users:delete", true},
+		{"admin:*", "admin", false},
+		{"admin", "admin:*", true},
+		{"*", "anything:at:all", true},
+		{"admin", "billing:read reports:orders:daily", true},
+		{"billing", "orders", false},
+		{"orders", "", true},
+	}
+	for _, r := range table {
+		granted, requested := ParseScope(r.granted), ParseScope(r.requested)
+		if res := h.Contains(granted, requested); res != r.expected {
+			t.Fatalf("%s contains %s: EXPECTED = %t - GOT = %t", r.granted, r.requested, r.expected, res)
+		}
+	}
+
+	var exact *ScopeHierarchy
+	if exact.Contains(ParseScope("orders"), ParseScope("orders:read")) {
+		t.Fatal("a nil hierarchy should compare actions exactly")
+	}
+	if !h.Equals(ParseScope("orders orders:read"), ParseScope("orders")) {
+		t.Fatal("scopes granting the same actions should be equal")
+	}
+}
+
+func TestGrant_scopeHierarchy(t *testing.T) {
+	p := *testProvider
+	client := NewClient("Test Client", ClientCredentials)
+	client.Scope = ParseScope("orders admin:*")
+	client.Status = ClientActive
+	if err := p.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	grant := func(scope string) int {
+		form := url.Values{
+			"grant_type":    {ClientCredentials},
+			"client_id":     {client.ID},
+			"client_secret": {client.Secret},
+			"scope":         {scope},
+		}
+		r := httptest.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := handleGrant(&context{&p, w, r, time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code
+	}
+
+	if status := grant("orders:read admin:users"); status != http.StatusForbidden {
+		t.Fatalf("without a hierarchy: EXPECTED = %d - GOT = %d", http.StatusForbidden, status)
+	}
+	p.ScopeHierarchy = NewScopeHierarchy(nil)
+	if status := grant("orders:read admin:users"); status != http.StatusOK {
+		t.Fatalf("with a hierarchy: EXPECTED = %d - GOT = %d", http.StatusOK, status)
+	}
+	if status := grant("billing"); status != http.StatusForbidden {
+		t.Fatalf("outside the hierarchy: EXPECTED = %d - GOT = %d", http.StatusForbidden, status)
+	}
+}
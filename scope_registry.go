@@ -0,0 +1,140 @@
+package ohauth
+
+import (
+	"log"
+	"sort"
+)
+
+// ScopeDefinition describes an action registered with a ScopeRegistry
+type ScopeDefinition struct {
+	// Description is shown to resource owners when they are asked for consent
+	Description string
+	// Default actions are requested on behalf of clients that omit the scope
+	// parameter, as far as the client's own scope grants them
+	Default bool
+	// GrantTypes restricts the grant types under which the action may be
+	// issued. It may be issued under any grant type if it is empty.
+	GrantTypes []string
+	// FirstParty restricts the action to first-party clients
+	FirstParty bool
+	// Deprecated actions are still issued but every request for them is
+	// logged so that the clients using them can be found
+	Deprecated bool
+}
+
+// ScopeRegistry lists the actions supported by a provider. Actions that are
+// not registered are not permitted under any grant type. With a
+// ScopeHierarchy an action that is not registered itself is described and
+// restricted by the most specific registered action that grants it.
+type ScopeRegistry struct {
+	Scopes map[string]*ScopeDefinition
+	// Logger records requests for deprecated actions. The standard logger is
+	// used if it is nil.
+	Logger *log.Logger
+}
+
+// NewScopeRegistry creates a scope registry with the specified definitions
+func NewScopeRegistry(scopes map[string]*ScopeDefinition) *ScopeRegistry {
+	return &ScopeRegistry{scopes, nil}
+}
+
+// definition returns the definition of an action or nil if it is not
+// registered. Of several granting actions of the same length the first in
+// lexical order is used.
+func (r *ScopeRegistry) definition(h *ScopeHierarchy, action string) *ScopeDefinition {
+	if d, found := r.Scopes[action]; found || h == nil {
+		return d
+	}
+	match := ""
+	for a := range r.Scopes {
+		longer := len(a) > len(match) || len(a) == len(match) && a < match
+		if longer && h.Grants(Scope{a: true}, action) {
+			match = a
+		}
+	}
+	return r.Scopes[match]
+}
+
+func (r *ScopeRegistry) logf(format string, v ...interface{}) {
+	if r.Logger == nil {
+		log.Printf(format, v...)
+		return
+	}
+	r.Logger.Printf(format, v...)
+}
+
+// permitted determines if every action of a scope is registered and may be
+// issued to a client under a grant type
+func (r *ScopeRegistry) permitted(h *ScopeHierarchy, c *Client, scope Scope, grantType string) bool {
+	for _, action := range scope.Values() {
+		d := r.definition(h, action)
+		if d == nil {
+			return false
+		}
+		if len(d.GrantTypes) > 0 && !containsString(d.GrantTypes, grantType) {
+			return false
+		}
+		if d.FirstParty && !c.FirstParty {
+			return false
+		}
+		if d.Deprecated {
+			r.logf("ohauth: client %s requested deprecated scope %s", c.ID, action)
+		}
+	}
+	return true
+}
+
+// Supported returns the registered actions that are not deprecated
+func (r *ScopeRegistry) Supported() []string {
+	out := []string{}
+	for a, d := range r.Scopes {
+		if !d.Deprecated {
+			out = append(out, a)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// scopePermitted determines if a scope may be issued to a client under a
+// grant type. Both the provider's Issuer and its ScopeRegistry, if it has one,
+// must permit it.
+func (p *Provider) scopePermitted(c *Client, scope Scope, grantType string) bool {
+	if !p.Issuer.ScopePermitted(scope, grantType) {
+		return false
+	}
+	return p.ScopeRegistry == nil || p.ScopeRegistry.permitted(p.ScopeHierarchy, c, scope, grantType)
+}
+
+// requestedScope parses the scope parameter of a request. A client that omits
+// it requests the registry's default actions that its own scope grants
+// (rfc6749 section 3.3).
+func (p *Provider) requestedScope(c *Client, raw string) Scope {
+	if raw != "" || p.ScopeRegistry == nil {
+		return ParseScope(raw)
+	}
+	s := Scope{}
+	for a, d := range p.ScopeRegistry.Scopes {
+		if d.Default && p.ScopeHierarchy.Grants(c.Scope, a) {
+			s[a] = true
+		}
+	}
+	return s
+}
+
+// DescribeScope returns the descriptions of the actions of a scope registered
+// with the provider's ScopeRegistry so that they can be shown to resource
+// owners when they are asked for consent. Actions without a description are
+// left out.
+func (p *Provider) DescribeScope(scope Scope) map[string]string {
+	out := map[string]string{}
+	if p.ScopeRegistry == nil {
+		return out
+	}
+	for a := range scope {
+		if d := p.ScopeRegistry.definition(p.ScopeHierarchy, a); d != nil && d.Description != "" {
+			out[a] = d.Description
+		}
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package ohauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScopeRegistryPermitted(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := NewScopeRegistry(map[string]*ScopeDefinition{
+		"orders":  {Description: "Manage your orders"},
+		"reports": {GrantTypes: []string{ClientCredentials}},
+		"admin":   {FirstParty: true},
+		"legacy":  {Deprecated: true},
+	})
+	r.Logger = log.New(buf, "", 0)
+	c := NewClient("Test Client")
+	first := NewClient("First Party Client")
+	first.FirstParty = true
+
+	table := []struct {
+		client *Client
+		scope  string
+		grant  string
+		h      *ScopeHierarchy
+		expect bool
+	}{
+		{c, "orders", Password, nil, true},
+		{c, "orders unknown", Password, nil, false},
+		{c, "orders:read", Password, nil, false},
+		{c, "orders:read", Password, NewScopeHierarchy(nil), true},
+		{c, "reports", Password, nil, false},
+		{c, "reports", ClientCredentials, nil, true},
+		{c, "admin", Password, nil, false},
+		{first, "admin", Password, nil, true},
+		{c, "legacy", Password, nil, true},
+	}
+	for _, row := range table {
+		if res := r.permitted(row.h, row.client, ParseScope(row.scope), row.grant); res != row.expect {
+			t.Fatalf("%s under %s: EXPECTED = %t - GOT = %t", row.scope, row.grant, row.expect, res)
+		}
+	}
+	if !strings.Contains(buf.String(), "deprecated scope legacy") {
+		t.Fatalf("EXPECTED deprecated scope to be logged - GOT = %q", buf.String())
+	}
+	if s := r.Supported(); strings.Join(s, " ") != "admin orders reports" {
+		t.Fatalf("EXPECTED = admin orders reports - GOT = %s", s)
+	}
+}
+
+func TestScopeRegistryDefinition(t *testing.T) {
+	r := NewScopeRegistry(map[string]*ScopeDefinition{
+		"orders:*": {Description: "Manage your orders"},
+		"shop:all": {Description: "Manage your shop"},
+		"orders":   {Description: "Everything about orders"},
+	})
+	h := NewScopeHierarchy(map[string]Scope{"shop:all": ParseScope("orders:read")})
+	for i := 0; i < 20; i++ {
+		if d := r.definition(h, "orders:read"); d == nil || d.Description != "Manage your orders" {
+			t.Fatalf("EXPECTED = Manage your orders - GOT = %+v", d)
+		}
+	}
+}
+
+func TestGrant_scopeRegistry(t *testing.T) {
+	p := *testProvider
+	p.ScopeRegistry = NewScopeRegistry(map[string]*ScopeDefinition{
+		"orders":  {Description: "Manage your orders", Default: true},
+		"billing": {Description: "View your invoices", Default: true},
+		"admin":   {FirstParty: true},
+	})
+	client := NewClient("Test Client", ClientCredentials)
+	client.Scope = ParseScope("orders admin")
+	client.Status = ClientActive
+	if err := p.Store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	grant := func(form url.Values) (int, map[string]interface{}) {
+		form.Set("grant_type", ClientCredentials)
+		form.Set("client_id", client.ID)
+		form.Set("client_secret", client.Secret)
+		r := httptest.NewRequest("POST", "https://authz.example.com/token", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := handleGrant(&context{&p, w, r, time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]interface{}{}
+		if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, out
+	}
+
+	status, out := grant(url.Values{})
+	if status != http.StatusOK {
+		t.Fatalf("EXPECTED = %d - GOT = %d %v", http.StatusOK, status, out)
+	}
+	at, err := p.Tokenizer.Parse(out["access_token"].(string), client.Keys.Verify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !at.Scope.Equals(ParseScope("orders")) {
+		t.Fatalf("EXPECTED the defaults granted to the client - GOT = %s", at.Scope)
+	}
+	if status, out := grant(url.Values{"scope": {"admin"}}); status != http.StatusForbidden {
+		t.Fatalf("first-party scope: EXPECTED = %d - GOT = %d %v", http.StatusForbidden, status, out)
+	}
+
+	if md := p.metadata(); strings.Join(md.ScopesSupported, " ") != "admin billing orders" {
+		t.Fatalf("EXPECTED registered scopes to be published - GOT = %s", md.ScopesSupported)
+	}
+	descs := p.DescribeScope(ParseScope("orders admin"))
+	if len(descs) != 1 || descs["orders"] != "Manage your orders" {
+		t.Fatalf("EXPECTED scope descriptions - GOT = %v", descs)
+	}
+}
@@ -3,21 +3,31 @@ package ohauth
 import (
 	"encoding/json"
 	"regexp"
+	"sort"
 	"strings"
 )
 
-var actionRE = regexp.MustCompile(`^\w+$`)
+// scope tokens are made up of NQCHAR characters (rfc6749 appendix A.4)
+var actionRE = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+
+// AcceptCommaSeparatedScopes makes ParseScope treat commas as separators as
+// well as spaces, which is how scopes were written before they followed
+// rfc6749. Scope tokens cannot contain commas while it is set. It is set by
+// default so that existing clients and stored scopes keep working while they
+// are migrated.
+var AcceptCommaSeparatedScopes = true
 
 // Scope is a set of actions defined on resources that clients may request from
 // resource owners
 type Scope map[string]bool
 
-// ParseScope takes raw comma-separated string and parses into a scope object
+// ParseScope parses a list of space-delimited scope tokens (rfc6749 section
+// 3.3) into a scope object. Tokens with characters outside of NQCHAR are
+// ignored.
 func ParseScope(raw string) Scope {
-	split := strings.Split(raw, ",")
-	for i, v := range split {
-		split[i] = strings.TrimSpace(v)
-	}
+	split := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ' ' || AcceptCommaSeparatedScopes && r == ','
+	})
 	s := Scope{}
 	s.Add(split...)
 	return s
@@ -57,7 +67,7 @@ func (s Scope) Equals(s2 Scope) bool {
 	return len(s) == len(s2) && s.Contains(s2)
 }
 
-// Values returns a list of actions held by a scope object
+// Values returns a sorted list of actions held by a scope object
 func (s Scope) Values() []string {
 	out := make([]string, len(s))
 	i := 0
@@ -65,11 +75,14 @@ func (s Scope) Values() []string {
 		out[i] = k
 		i++
 	}
+	sort.Strings(out)
 	return out
 }
 
+// String returns the space-delimited form of a scope used in requests,
+// responses and token claims
 func (s Scope) String() string {
-	return strings.Join(s.Values(), ",")
+	return strings.Join(s.Values(), " ")
 }
 
 // MarshalJSON implements the json.Marshaler interface
@@ -78,7 +91,7 @@ func (s Scope) MarshalJSON() ([]byte, error) {
 }
 
 // UnmarshalJSON implements the json.Unmarshaler interface for converting JSON
-// string of comma-separated scope actions and uses to populate a Scope object
+// string of space-delimited scope actions and uses to populate a Scope object
 func (s *Scope) UnmarshalJSON(inp []byte) error {
 	raw := ""
 	if err := json.Unmarshal(inp, &raw); err != nil {
@@ -20,8 +20,16 @@ func TestParseScope(t *testing.T) {
 			[]string{"user_email", "order_cancel", "user_friends"},
 		},
 		{
-			"user_email!!,  order_cancel,00user_friends,bad-action",
-			[]string{"order_cancel", "00user_friends"},
+			"user_email!!,  order_cancel,00user_friends,bad\\action",
+			[]string{"user_email!!", "order_cancel", "00user_friends"},
+		},
+		{
+			"openid read:users  https://api.example.com/orders",
+			[]string{"openid", "read:users", "https://api.example.com/orders"},
+		},
+		{
+			"user_email \"quoted\" order_cancel",
+			[]string{"user_email", "order_cancel"},
 		},
 		{
 			"",
@@ -42,6 +50,23 @@ func TestParseScope(t *testing.T) {
 	}
 }
 
+func TestParseScope_withoutCommas(t *testing.T) {
+	AcceptCommaSeparatedScopes = false
+	defer func() { AcceptCommaSeparatedScopes = true }()
+
+	s := ParseScope("user_email order_cancel,user_friends")
+	if !s.Equals(Scope{"user_email": true, "order_cancel,user_friends": true}) {
+		t.Fatalf("EXPECTED commas to be part of a token - GOT = %s", s)
+	}
+}
+
+func TestScopeString(t *testing.T) {
+	s := ParseScope("user_email,order_cancel download_report")
+	if out := s.String(); out != "download_report order_cancel user_email" {
+		t.Fatalf("EXPECTED = %s - GOT = %s", "download_report order_cancel user_email", out)
+	}
+}
+
 func TestScopeContains(t *testing.T) {
 	table := []struct {
 		in1, in2 string
@@ -113,7 +138,7 @@ func TestScopeMarshalJSON(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	out := strings.Split(strings.Trim(string(j), `"`), ",")
+	out := strings.Split(strings.Trim(string(j), `"`), " ")
 	pass := len(out) == len(s)
 	for _, v := range out {
 		_, ok := s[v]
@@ -1,5 +1,7 @@
 package ohauth
 
+import "time"
+
 // Store defines an interface that is used to store/retrieve/manipulate objects
 // used throughout the OAuth framework (typically a database).
 type Store interface {
@@ -20,3 +22,114 @@ type Store interface {
 	// FetchAuthorization retrieves an Authorization record
 	FetchAuthorization(cid string, sub string) (*Authorization, error)
 }
+
+// ClientUpdater may be implemented by a Store to update registered clients.
+// Registered clients cannot update themselves through the client configuration
+// endpoint with stores that do not implement it.
+type ClientUpdater interface {
+	// UpdateClient replaces a stored client with an updated copy
+	UpdateClient(*Client) error
+}
+
+// ReplayStore may be implemented by a Store to remember the ids of one-time
+// assertions and DPoP proofs only until they expire. Stores that do not
+// implement it keep those ids in the token blacklist, which never forgets them.
+type ReplayStore interface {
+	// RecordUse records the use of an id until it expires and reports whether
+	// it was already in use, in a single step
+	RecordUse(id string, exp time.Time) (bool, error)
+}
+
+// DeviceStore may be implemented by a Store to keep device authorizations. The
+// device authorization grant is disabled for stores that do not implement it.
+type DeviceStore interface {
+	// StoreDeviceAuthorization saves a new or updated device authorization
+	StoreDeviceAuthorization(d *DeviceAuthorization) error
+	// FetchDeviceAuthorization retrieves a device authorization by device code
+	FetchDeviceAuthorization(deviceCode string) (*DeviceAuthorization, error)
+	// FetchDeviceAuthorizationByUserCode retrieves a device authorization by
+	// the user code shown to the resource owner
+	FetchDeviceAuthorizationByUserCode(userCode string) (*DeviceAuthorization, error)
+	// RedeemDeviceAuthorization marks an approved device authorization as
+	// redeemed in a single step and reports whether it was approved, so that
+	// concurrent requests cannot redeem a device code twice
+	RedeemDeviceAuthorization(deviceCode string) (bool, error)
+}
+
+// PushedRequestStore may be implemented by a Store to keep pushed
+// authorization requests. Pushed authorization requests are disabled for
+// stores that do not implement it.
+type PushedRequestStore interface {
+	// StorePushedRequest saves a pushed authorization request
+	StorePushedRequest(pr *PushedRequest) error
+	// FetchPushedRequest retrieves a pushed authorization request by its
+	// request_uri
+	FetchPushedRequest(requestURI string) (*PushedRequest, error)
+}
+
+// BackchannelStore may be implemented by a Store to keep backchannel
+// authentication requests. Backchannel authentication is disabled for stores
+// that do not implement it.
+type BackchannelStore interface {
+	// StoreBackchannelAuthentication saves a new or updated backchannel
+	// authentication request
+	StoreBackchannelAuthentication(b *BackchannelAuthentication) error
+	// FetchBackchannelAuthentication retrieves a backchannel authentication
+	// request by its auth_req_id
+	FetchBackchannelAuthentication(authReqID string) (*BackchannelAuthentication, error)
+}
+
+// clientUpdater returns the provider's store if it updates clients
+func (p *Provider) clientUpdater() ClientUpdater {
+	cu, _ := p.Store.(ClientUpdater)
+	return cu
+}
+
+// replayed records the use of a one-time id until it expires and reports
+// whether it had already been used
+func replayed(store Store, id string, exp time.Time) (bool, error) {
+	if rs, ok := store.(ReplayStore); ok {
+		return rs.RecordUse(id, exp)
+	}
+	used, err := store.TokenBlacklisted(id)
+	if err != nil || used {
+		return used, err
+	}
+	return false, store.BlacklistToken(id)
+}
+
+// deviceStore returns the provider's store if it keeps device authorizations
+func (p *Provider) deviceStore() DeviceStore {
+	ds, _ := p.Store.(DeviceStore)
+	return ds
+}
+
+// pushedRequestStore returns the provider's store if it keeps pushed
+// authorization requests
+func (p *Provider) pushedRequestStore() PushedRequestStore {
+	ps, _ := p.Store.(PushedRequestStore)
+	return ps
+}
+
+// backchannelStore returns the provider's store if backchannel authentication
+// is enabled, which also requires an Approver and the provider keys that sign
+// ID tokens and verify ID token hints
+func (p *Provider) backchannelStore() BackchannelStore {
+	bs, _ := p.Store.(BackchannelStore)
+	if p.Approver == nil || p.Keys == nil {
+		return nil
+	}
+	return bs
+}
+
+// grantEnabled determines if a grant type is available with the provider's
+// configuration
+func (p *Provider) grantEnabled(gt string) bool {
+	switch gt {
+	case DeviceCode:
+		return p.deviceStore() != nil
+	case CIBA:
+		return p.backchannelStore() != nil
+	}
+	return true
+}
@@ -3,16 +3,24 @@ package ohauth
 import (
 	"fmt"
 	"sync"
+	"time"
 )
 
 // TestingStore is a Store implementation that may be used for testing and
-// experimenting with OhAuth. It is a simple memory-based store.
+// experimenting with OhAuth. It is a simple memory-based store that also
+// implements ClientUpdater, ReplayStore, DeviceStore, PushedRequestStore and
+// BackchannelStore.
 type TestingStore struct {
 	*sync.Mutex
 	authz     map[string]*Authorization
 	clients   map[string]*Client
 	tokens    map[string]*TokenClaims
 	blacklist map[string]bool
+	devices   map[string]*DeviceAuthorization
+	userCodes map[string]string
+	pushed    map[string]*PushedRequest
+	ciba      map[string]*BackchannelAuthentication
+	replays   map[string]time.Time
 }
 
 // NewTestingStore creates an instace of a TestingStore
@@ -23,6 +31,11 @@ func NewTestingStore() (*TestingStore, error) {
 		make(map[string]*Client, 0),
 		make(map[string]*TokenClaims, 0),
 		make(map[string]bool, 0),
+		make(map[string]*DeviceAuthorization, 0),
+		make(map[string]string, 0),
+		make(map[string]*PushedRequest, 0),
+		make(map[string]*BackchannelAuthentication, 0),
+		make(map[string]time.Time, 0),
 	}, nil
 }
 
@@ -60,6 +73,24 @@ func (s *TestingStore) TokenBlacklisted(id string) (bool, error) {
 	return s.blacklist[id], nil
 }
 
+// RecordUse records the use of an id until it expires and reports whether it
+// was already in use. Expired ids are forgotten along the way.
+func (s *TestingStore) RecordUse(id string, exp time.Time) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	for k, e := range s.replays {
+		if !e.After(now) {
+			delete(s.replays, k)
+		}
+	}
+	if _, used := s.replays[id]; used {
+		return true, nil
+	}
+	s.replays[id] = exp
+	return false, nil
+}
+
 // StoreAuthorization records a resource owner's authorisation of a client
 func (s *TestingStore) StoreAuthorization(a *Authorization) error {
 	s.Lock()
@@ -72,3 +103,81 @@ func (s *TestingStore) StoreAuthorization(a *Authorization) error {
 func (s *TestingStore) FetchAuthorization(cid, uid string) (*Authorization, error) {
 	return s.authz[fmt.Sprintf("%s:%s", cid, uid)], nil
 }
+
+// UpdateClient replaces a stored client with an updated copy
+func (s *TestingStore) UpdateClient(c *Client) error {
+	s.Lock()
+	defer s.Unlock()
+	s.clients[c.ID] = c
+	return nil
+}
+
+// StoreDeviceAuthorization saves a new or updated device authorization
+func (s *TestingStore) StoreDeviceAuthorization(d *DeviceAuthorization) error {
+	s.Lock()
+	defer s.Unlock()
+	s.devices[d.DeviceCode] = d
+	s.userCodes[d.UserCode] = d.DeviceCode
+	return nil
+}
+
+// FetchDeviceAuthorization retrieves a device authorization by device code
+func (s *TestingStore) FetchDeviceAuthorization(deviceCode string) (*DeviceAuthorization, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.devices[deviceCode], nil
+}
+
+// FetchDeviceAuthorizationByUserCode retrieves a device authorization by the
+// user code shown to the resource owner
+func (s *TestingStore) FetchDeviceAuthorizationByUserCode(userCode string) (*DeviceAuthorization, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.devices[s.userCodes[userCode]], nil
+}
+
+// RedeemDeviceAuthorization marks an approved device authorization as
+// redeemed in a single step and reports whether it was approved
+func (s *TestingStore) RedeemDeviceAuthorization(deviceCode string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	d := s.devices[deviceCode]
+	if d == nil || d.Status != DeviceApproved {
+		return false, nil
+	}
+	d.Status = DeviceRedeemed
+	return true, nil
+}
+
+// StorePushedRequest saves a pushed authorization request
+func (s *TestingStore) StorePushedRequest(pr *PushedRequest) error {
+	s.Lock()
+	defer s.Unlock()
+	s.pushed[pr.RequestURI] = pr
+	return nil
+}
+
+// FetchPushedRequest retrieves a pushed authorization request by its
+// request_uri
+func (s *TestingStore) FetchPushedRequest(requestURI string) (*PushedRequest, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.pushed[requestURI], nil
+}
+
+// StoreBackchannelAuthentication saves a new or updated backchannel
+// authentication request
+func (s *TestingStore) StoreBackchannelAuthentication(b *BackchannelAuthentication) error {
+	s.Lock()
+	defer s.Unlock()
+	s.ciba[b.AuthReqID] = b
+	return nil
+}
+
+// FetchBackchannelAuthentication retrieves a backchannel authentication
+// request by its auth_req_id
+func (s *TestingStore) FetchBackchannelAuthentication(authReqID string) (*BackchannelAuthentication, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.ciba[authReqID], nil
+}
@@ -1,8 +1,12 @@
 package ohauth
 
 import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/mitchellh/mapstructure"
@@ -19,6 +23,13 @@ type Tokenizer interface {
 	Parse(token string, verifyKey []byte) (*TokenClaims, error)
 }
 
+// Inspector may be implemented by a Tokenizer that can read the claims of a
+// token without verifying it. Providers use it to find the client whose keys
+// verify a token presented by a third party such as a resource server.
+type Inspector interface {
+	Inspect(token string) (*TokenClaims, error)
+}
+
 type jwtTokenizer struct {
 	method jwt.SigningMethod
 }
@@ -52,6 +63,23 @@ func (t *jwtTokenizer) Parse(raw string, verifyKey []byte) (*TokenClaims, error)
 		return nil, err
 	}
 
+	return decodeClaims(token.Claims)
+}
+
+// Inspect decodes the claims of a JWT token without verifying its signature
+func (t *jwtTokenizer) Inspect(raw string) (*TokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Token contains an invalid number of segments")
+	}
+	m, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return decodeClaims(m)
+}
+
+func decodeClaims(claims interface{}) (*TokenClaims, error) {
 	tc := &TokenClaims{}
 
 	d, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
@@ -67,7 +95,7 @@ func (t *jwtTokenizer) Parse(raw string, verifyKey []byte) (*TokenClaims, error)
 	if err != nil {
 		return nil, err
 	}
-	err = d.Decode(token.Claims)
+	err = d.Decode(claims)
 	if err != nil {
 		return nil, err
 	}
@@ -93,5 +121,131 @@ func tokenClaimsToMap(tc *TokenClaims) map[string]interface{} {
 	if tc.Nonce != "" {
 		m["nonce"] = tc.Nonce
 	}
+	if tc.AuthTime != 0 {
+		m["auth_time"] = tc.AuthTime
+	}
+	if tc.AccessTokenHash != "" {
+		m["at_hash"] = tc.AccessTokenHash
+	}
+	if tc.CodeHash != "" {
+		m["c_hash"] = tc.CodeHash
+	}
+	if tc.AuthorizedParty != "" {
+		m["azp"] = tc.AuthorizedParty
+	}
+	if tc.AuthReqID != "" {
+		m["urn:openid:params:jwt:claim:auth_req_id"] = tc.AuthReqID
+	}
+	if tc.RefreshTokenHash != "" {
+		m["urn:openid:params:jwt:claim:rt_hash"] = tc.RefreshTokenHash
+	}
+	if tc.Challenge != "" {
+		m["code_challenge"] = tc.Challenge
+		m["code_challenge_method"] = tc.ChallengeMethod
+	}
+	if tc.RedirectURI != "" {
+		m["redirect_uri"] = tc.RedirectURI
+	}
+	if tc.RedirectURISent {
+		m["redirect_uri_sent"] = true
+	}
+	if tc.ClientID != "" {
+		m["client_id"] = tc.ClientID
+	}
+	if len(tc.Resources) > 0 {
+		m["resources"] = tc.Resources
+	}
+	if tc.Actor != nil {
+		m["act"] = tc.Actor
+	}
+	if tc.Owner != "" {
+		m["owner"] = tc.Owner
+	}
+	if tc.GrantID != "" {
+		m["grant_id"] = tc.GrantID
+	}
+	if tc.Confirmation != nil {
+		m["cnf"] = tc.Confirmation
+	}
+	if len(tc.AuthorizationDetails) > 0 {
+		m["authorization_details"] = tc.AuthorizationDetails
+	}
 	return m
 }
+
+// signClaims creates a JWT carrying arbitrary claims and header values. It is
+// used for documents that are not represented by TokenClaims.
+func signClaims(method jwt.SigningMethod, typ string, claims map[string]interface{}, signingKey []byte) (string, error) {
+	token := jwt.New(method)
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	token.Claims = claims
+	return token.SignedString(signingKey)
+}
+
+// keyFunc selects the key that verifies a JWT using its unverified header and
+// claims. It returns a parsed public key or, for HMAC algorithms, a secret.
+type keyFunc func(header, claims map[string]interface{}) (interface{}, error)
+
+// parseSignedClaims verifies a JWT that was not produced by a Tokenizer, such as
+// an assertion or software statement signed by a third party, and returns its
+// claims. The algorithm in the token header must match the type of key chosen
+// by keyFn which prevents algorithm substitution.
+func parseSignedClaims(raw string, keyFn keyFunc) (map[string]interface{}, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("Token contains an invalid number of segments")
+	}
+	header, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	claims, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keyFn(header, claims)
+	if err != nil {
+		return nil, err
+	}
+	_, err = jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		if !methodMatchesKey(token.Method, key) {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes the JSON object in a JWT header or payload segment
+func decodeSegment(seg string) (map[string]interface{}, error) {
+	b, err := jwt.DecodeSegment(seg)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func methodMatchesKey(method jwt.SigningMethod, key interface{}) bool {
+	switch method.(type) {
+	case *jwt.SigningMethodRSA:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.(*ecdsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodHMAC:
+		_, ok := key.([]byte)
+		return ok
+	}
+	return false
+}
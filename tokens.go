@@ -16,6 +16,9 @@ type TokenClaims struct {
 	ID       string `json:"jti"`
 	Role     string `json:"role"`
 	Audience string `json:"aud"`
+	// ClientID identifies the client an access token was issued to when its
+	// audience is a protected resource rather than the client itself
+	ClientID string `json:"client_id,omitempty"`
 	Expires  int64  `json:"exp"`
 	Issued   int64  `json:"iat"`
 	Issuer   string `json:"iss"`
@@ -23,6 +26,79 @@ type TokenClaims struct {
 	Grant    string `json:"grant"`
 	Scope    Scope  `json:"scope,omitempty"`
 	Nonce    string `json:"nonce,omitempty"`
+	// AuthTime, AccessTokenHash, CodeHash and AuthorizedParty are the OpenID
+	// Connect claims carried by ID tokens
+	AuthTime        int64  `json:"auth_time,omitempty"`
+	AccessTokenHash string `json:"at_hash,omitempty"`
+	CodeHash        string `json:"c_hash,omitempty"`
+	AuthorizedParty string `json:"azp,omitempty"`
+	// AuthReqID and RefreshTokenHash identify the request and refresh token an
+	// ID token pushed to a backchannel authentication client belongs to
+	AuthReqID        string `json:"urn:openid:params:jwt:claim:auth_req_id,omitempty"`
+	RefreshTokenHash string `json:"urn:openid:params:jwt:claim:rt_hash,omitempty"`
+	// Challenge and ChallengeMethod record a PKCE code challenge in codes
+	Challenge       string `json:"code_challenge,omitempty"`
+	ChallengeMethod string `json:"code_challenge_method,omitempty"`
+	// RedirectURI records the redirect uri a code was delivered to so that the
+	// same uri is used when it is redeemed. RedirectURISent records that the
+	// authorization request named it, which requires the token request to name
+	// it as well.
+	RedirectURI     string `json:"redirect_uri,omitempty"`
+	RedirectURISent bool   `json:"redirect_uri_sent,omitempty"`
+	// Resources records the protected resources (rfc8707) that codes and
+	// refresh tokens may be exchanged for access tokens for
+	Resources []string `json:"resources,omitempty"`
+	// Actor identifies the party acting on behalf of the subject of a token
+	// obtained through token exchange
+	Actor *Actor `json:"act,omitempty"`
+	// Owner identifies the resource owner of a refresh token since its subject
+	// is the access token it was issued alongside
+	Owner string `json:"owner,omitempty"`
+	// GrantID identifies the grant a refresh token and the access tokens
+	// obtained with it belong to so that they are revoked together. It is
+	// assigned when the grant is first issued and only revoking a refresh
+	// token revokes the whole grant.
+	GrantID string `json:"grant_id,omitempty"`
+	// Confirmation binds a token to a key held by the client (rfc7800)
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+	// AuthorizationDetails are the fine-grained permissions (rfc9396) granted
+	// along with the scope
+	AuthorizationDetails AuthorizationDetails `json:"authorization_details,omitempty"`
+}
+
+// clientID returns the id of the client a token was issued to. Tokens that do
+// not carry a client_id name the client as their audience.
+func (tc *TokenClaims) clientID() string {
+	if tc.ClientID != "" {
+		return tc.ClientID
+	}
+	return tc.Audience
+}
+
+// grantID returns the id of the grant a refresh token belongs to. Refresh
+// tokens issued without a grant_id belong to the access token they were issued
+// alongside.
+func (tc *TokenClaims) grantID() string {
+	if tc.GrantID != "" {
+		return tc.GrantID
+	}
+	return tc.Subject
+}
+
+// Confirmation is the cnf claim identifying the key a token is bound to
+type Confirmation struct {
+	// JWKThumbprint is the thumbprint of a DPoP proof key (rfc9449 section 6.1)
+	JWKThumbprint string `json:"jkt,omitempty"`
+	// X509Thumbprint is the thumbprint of a client certificate (rfc8705
+	// section 3.1)
+	X509Thumbprint string `json:"x5t#S256,omitempty"`
+}
+
+// Actor is the act claim defined in rfc8693 section 4.1. Prior actors in a
+// delegation chain are nested inside the current one.
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
 }
 
 // NewTokenClaims creates an instance of TokenClaims initialised with some basic
@@ -12,7 +12,8 @@ import (
 var ErrNotAbsoluteURL = errors.New("absolute urls with host are required")
 
 // StrictURL is similar to the standard net/url.URL type except that it can be
-// json marshalled and unmarshalled and forces all parsed urls to https protocol
+// json marshalled and unmarshalled. Urls parsed with ParseURL are forced to the
+// https protocol while native applications may use others (see ParseNativeURL).
 type StrictURL url.URL
 
 // ParseURL parses a string url and coerces the scheme to https, clears the
@@ -85,11 +86,8 @@ func (u *StrictURL) Compare(u2 *StrictURL) bool {
 
 // Clone creates a new copy of the StrictURL
 func (u *StrictURL) Clone() *StrictURL {
-	c, err := ParseURL(u.String())
-	if err != nil {
-		panic(err)
-	}
-	return c
+	c := *u
+	return &c
 }
 
 // StringWithParams returns a string representation of a StrictURL with